@@ -0,0 +1,100 @@
+// adaptive.go - adaptive cache capacity
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve
+
+import (
+	"sync/atomic"
+)
+
+// minimum number of lookups between two capacity adjustments
+const _MinAdaptWindow = 64
+
+// adaptive tracks the state needed to tune the cache capacity
+type adaptive struct {
+	min, max int
+	target   float64
+
+	// hit & miss counters at the last adjustment
+	hits, misses uint64
+
+	// total lookups at which the next adjustment is due
+	due atomic.Uint64
+}
+
+// NewAdaptive creates a new cache whose capacity is automatically
+// tuned between 'min' and 'max' entries to keep the hit ratio close
+// to 'target' (a value in (0, 1]).
+//
+// The capacity is re-evaluated once every window of lookups (the
+// larger of the current capacity and 64). When the hit ratio in the
+// window is below the target and the cache is full, the capacity grows
+// by a quarter; when the hit ratio is above the target, the capacity
+// shrinks by an eighth. The asymmetry avoids oscillating around the
+// target.
+func NewAdaptive[K comparable, V any](min, max int, target float64) *Sieve[K, V] {
+	return NewWithOptions[K, V](min, WithAdaptive[K, V](min, max, target))
+}
+
+// tune adjusts the capacity if a window of lookups has elapsed since
+// the last adjustment.
+func (s *Sieve[K, V]) tune() {
+	if s.adapt == nil {
+		return
+	}
+
+	n := s.stats.hits.Load() + s.stats.misses.Load()
+	if n < s.adapt.due.Load() {
+		return
+	}
+
+	s.mu.Lock()
+	s.adjust()
+	s.unlock()
+}
+
+// adjust the cache capacity toward the target hit ratio.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) adjust() {
+	a := s.adapt
+	hits := s.stats.hits.Load()
+	misses := s.stats.misses.Load()
+
+	window := uint64(max(s.capacity, _MinAdaptWindow))
+
+	// the stats were reset; start a new window
+	if hits < a.hits || misses < a.misses {
+		a.hits, a.misses = hits, misses
+		a.due.Store(hits + misses + window)
+		return
+	}
+
+	dh := hits - a.hits
+	dm := misses - a.misses
+	if dh+dm < window {
+		a.due.Store(a.hits + a.misses + window)
+		return
+	}
+
+	a.hits, a.misses = hits, misses
+
+	ratio := float64(dh) / float64(dh+dm)
+	switch {
+	case ratio < a.target && s.size >= s.capacity:
+		s.resize(min(a.max, s.capacity+max(1, s.capacity/4)))
+	case ratio > a.target:
+		s.resize(max(a.min, s.capacity-max(1, s.capacity/8)))
+	}
+	a.due.Store(hits + misses + uint64(max(s.capacity, _MinAdaptWindow)))
+}
@@ -0,0 +1,51 @@
+// adaptive_test.go - tests for adaptive capacity
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve_test
+
+import (
+	"testing"
+
+	"github.com/opencoff/go-sieve"
+)
+
+func TestAdaptive(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.NewAdaptive[int, int](64, 4096, 0.8)
+	assert(s.Cap() == 64, "exp initial cap 64, saw %d", s.Cap())
+
+	// working set of 1000 keys; much larger than initial capacity
+	for r := 0; r < 50; r++ {
+		for i := 0; i < 1000; i++ {
+			s.Probe(i, i)
+		}
+	}
+
+	grown := s.Cap()
+	assert(grown >= 1000, "exp cap to grow to working set, saw %d", grown)
+	assert(grown <= 4096, "exp cap to be bounded, saw %d", grown)
+
+	// now shrink the working set to 32 keys
+	for r := 0; r < 2000; r++ {
+		for i := 0; i < 32; i++ {
+			s.Probe(i, i)
+		}
+	}
+
+	shrunk := s.Cap()
+	assert(shrunk < grown, "exp cap to shrink from %d, saw %d", grown, shrunk)
+	assert(shrunk >= 64, "exp cap to be bounded by min, saw %d", shrunk)
+	assert(s.Len() <= shrunk, "len %d exceeds cap %d", s.Len(), shrunk)
+}
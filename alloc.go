@@ -0,0 +1,81 @@
+// alloc.go - pluggable allocation of cache nodes
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve
+
+// Allocator allocates and frees the nodes that hold the cache entries.
+// The default allocator recycles nodes through a sync.Pool.
+//
+// New must return a node that is not in use by the cache; it needn't
+// be zeroed. Free is called when a node leaves the cache. Both are
+// called with the cache lock held. A concurrent lookup may still be
+// reading a freed node: so its memory must remain valid (i.e., it may
+// be handed out again by New, but not unmapped).
+type Allocator[K comparable, V any] interface {
+	New() *Node[K, V]
+	Free(*Node[K, V])
+}
+
+// WithAllocator allocates the cache nodes from 'a' - e.g., an arena
+// or a slab allocator.
+func WithAllocator[K comparable, V any](a Allocator[K, V]) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.alloc = a
+	}
+}
+
+// WithPrealloc allocates 'n' nodes up front - in one block - and
+// recycles nodes through a free list instead of a sync.Pool; unlike
+// the latter, the free list isn't emptied by the garbage collector.
+// When 'n' covers the steady state size, adds and evictions don't
+// allocate nodes. This option replaces any allocator configured by
+// WithAllocator.
+func WithPrealloc[K comparable, V any](n int) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.alloc = newFreeList[K, V](n)
+	}
+}
+
+// freeList is an allocator that recycles nodes via a free list
+type freeList[K comparable, V any] struct {
+	free []*Node[K, V]
+}
+
+func newFreeList[K comparable, V any](n int) *freeList[K, V] {
+	n = max(n, 0)
+	f := &freeList[K, V]{
+		free: make([]*Node[K, V], n),
+	}
+
+	block := make([]Node[K, V], n)
+	for i := range block {
+		f.free[i] = &block[i]
+	}
+	return f
+}
+
+func (f *freeList[K, V]) New() *Node[K, V] {
+	n := len(f.free)
+	if n == 0 {
+		return new(Node[K, V])
+	}
+
+	x := f.free[n-1]
+	f.free = f.free[:n-1]
+	return x
+}
+
+func (f *freeList[K, V]) Free(x *Node[K, V]) {
+	f.free = append(f.free, x)
+}
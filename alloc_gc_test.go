@@ -0,0 +1,55 @@
+// alloc_gc_test.go -- allocation tests for the preallocated free list
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+// The race detector and the sievetest cache lock allocate on their own;
+// so the malloc counts are only exact without them.
+
+//go:build !race && !sievetest
+
+package sieve_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/opencoff/go-sieve"
+)
+
+func TestPreallocNoMalloc(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.NewWithOptions[uint64, uint64](1024,
+		sieve.WithStripes[uint64, uint64](16, mix64),
+		sieve.WithPrealloc[uint64, uint64](1024))
+	for i := uint64(0); i < 4096; i++ {
+		s.Add(i, i)
+	}
+
+	// unlike a sync.Pool, the free list survives garbage collection
+	var before, after runtime.MemStats
+	var mallocs uint64
+	for k := uint64(0); k < 4096; k++ {
+		if k%256 == 0 {
+			runtime.GC()
+			runtime.GC()
+		}
+		runtime.ReadMemStats(&before)
+		s.Add(k, k)
+		runtime.ReadMemStats(&after)
+		mallocs += after.Mallocs - before.Mallocs
+	}
+	assert(mallocs == 0, "exp no allocations, saw %d", mallocs)
+	assert(s.Len() == 1024, "exp a full cache, saw %d", s.Len())
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
@@ -0,0 +1,95 @@
+// alloc_test.go -- tests for custom node allocators
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve_test
+
+import (
+	"testing"
+
+	"github.com/opencoff/go-sieve"
+)
+
+// countingAlloc is a free list allocator that counts its calls
+type countingAlloc struct {
+	news, frees int
+	free        []*sieve.Node[int, int]
+}
+
+func (a *countingAlloc) New() *sieve.Node[int, int] {
+	a.news++
+	if n := len(a.free); n > 0 {
+		x := a.free[n-1]
+		a.free = a.free[:n-1]
+		return x
+	}
+	return new(sieve.Node[int, int])
+}
+
+func (a *countingAlloc) Free(n *sieve.Node[int, int]) {
+	a.frees++
+	a.free = append(a.free, n)
+}
+
+func TestAllocator(t *testing.T) {
+	assert := newAsserter(t)
+
+	a := &countingAlloc{}
+	s := sieve.NewWithOptions[int, int](8, sieve.WithAllocator[int, int](a))
+
+	// 8 adds fill the cache; the next 12 each evict one entry
+	for i := 0; i < 20; i++ {
+		s.Add(i, i)
+	}
+	assert(a.news == 20, "exp 20 allocs, saw %d", a.news)
+	assert(a.frees == 12, "exp 12 frees, saw %d", a.frees)
+
+	// replacing a value doesn't allocate
+	s.Add(19, 190)
+	assert(a.news == 20, "exp no alloc on replace, saw %d", a.news)
+
+	s.Delete(19)
+	assert(a.frees == 13, "exp 13 frees, saw %d", a.frees)
+
+	// purge frees every live node
+	s.Purge()
+	assert(a.frees == 20, "exp all nodes freed, saw %d", a.frees)
+	assert(a.news-a.frees == s.Len(), "leaked nodes: %d allocs %d frees", a.news, a.frees)
+
+	// freed nodes are reused without leaking old contents
+	for i := 100; i < 108; i++ {
+		s.Add(i, i)
+	}
+	for i := 100; i < 108; i++ {
+		v, ok := s.Get(i)
+		assert(ok && v == i, "%d: exp to find it, saw %d %v", i, v, ok)
+	}
+	assert(len(a.free) == 0, "exp free list to be drained, saw %d", len(a.free))
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
+
+func TestPrealloc(t *testing.T) {
+	assert := newAsserter(t)
+
+	// running out of preallocated nodes falls back to the heap
+	p := sieve.NewWithOptions[int, int](8, sieve.WithPrealloc[int, int](2))
+	for i := 0; i < 16; i++ {
+		p.Add(i, i)
+	}
+	assert(p.Len() == 8, "exp 8 entries, saw %d", p.Len())
+	for i := 8; i < 16; i++ {
+		v, ok := p.Get(i)
+		assert(ok && v == i, "%d: exp to find it, saw %d %v", i, v, ok)
+	}
+	assert(p.Validate() == nil, "invariants: %v", p.Validate())
+}
@@ -0,0 +1,73 @@
+// bytes.go - cache keyed by byte slices
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve
+
+// BytesSieve is a cache keyed by byte slices. Byte slices aren't
+// comparable; so the keys are stored as strings - which copies them.
+// Callers can freely modify a key after adding it.
+type BytesSieve[V any] struct {
+	s *Sieve[string, V]
+}
+
+// NewBytes creates a new cache of size 'capacity' mapping byte slice
+// keys to values of type 'V' - configured by the given options.
+func NewBytes[V any](capacity int, opts ...Option[string, V]) *BytesSieve[V] {
+	b := &BytesSieve[V]{
+		s: NewWithOptions[string, V](capacity, opts...),
+	}
+	return b
+}
+
+// Get fetches the value for 'key'; see Sieve.Get
+func (b *BytesSieve[V]) Get(key []byte) (V, bool) {
+	return b.s.Get(string(key))
+}
+
+// Add adds or replaces the value for a copy of 'key'; see Sieve.Add
+func (b *BytesSieve[V]) Add(key []byte, val V) bool {
+	return b.s.Add(string(key), val)
+}
+
+// Probe adds 'val' for a copy of 'key' if it isn't in the cache; see
+// Sieve.Probe
+func (b *BytesSieve[V]) Probe(key []byte, val V) (V, bool) {
+	return b.s.Probe(string(key), val)
+}
+
+// Delete deletes 'key' from the cache; see Sieve.Delete
+func (b *BytesSieve[V]) Delete(key []byte) bool {
+	return b.s.Delete(string(key))
+}
+
+// Len returns the number of entries in the cache
+func (b *BytesSieve[V]) Len() int {
+	return b.s.Len()
+}
+
+// Cap returns the capacity of the cache
+func (b *BytesSieve[V]) Cap() int {
+	return b.s.Cap()
+}
+
+// Purge removes all the entries from the cache
+func (b *BytesSieve[V]) Purge() {
+	b.s.Purge()
+}
+
+// Sieve returns the underlying cache keyed by the string form of the
+// byte slice keys - for the operations not wrapped by BytesSieve.
+func (b *BytesSieve[V]) Sieve() *Sieve[string, V] {
+	return b.s
+}
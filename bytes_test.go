@@ -0,0 +1,56 @@
+// bytes_test.go -- tests for the byte slice keyed cache
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve_test
+
+import (
+	"testing"
+
+	"github.com/opencoff/go-sieve"
+)
+
+func TestBytes(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.NewBytes[int](4)
+
+	key := []byte("hello")
+	assert(!s.Add(key, 1), "exp insert of new key")
+
+	// mutating the caller's slice doesn't affect the cached key
+	copy(key, "jello")
+	_, ok := s.Get(key)
+	assert(!ok, "exp miss on the mutated key")
+	v, ok := s.Get([]byte("hello"))
+	assert(ok && v == 1, "exp 1 for the original key, saw %d %v", v, ok)
+
+	assert(s.Add([]byte("hello"), 2), "exp replace of existing key")
+	v, ok = s.Probe([]byte("hello"), 3)
+	assert(ok && v == 2, "exp probe hit, saw %d %v", v, ok)
+	v, ok = s.Probe(key, 3)
+	assert(!ok && v == 3, "exp probe insert, saw %d %v", v, ok)
+	assert(s.Len() == 2, "exp 2 entries, saw %d", s.Len())
+
+	// nil and empty keys are the same key
+	s.Add(nil, 4)
+	v, ok = s.Get([]byte{})
+	assert(ok && v == 4, "exp 4 for the empty key, saw %d %v", v, ok)
+
+	assert(s.Delete([]byte("jello")), "exp delete")
+	_, ok = s.Sieve().Get("jello")
+	assert(!ok, "exp jello to be gone")
+
+	s.Purge()
+	assert(s.Len() == 0 && s.Cap() == 4, "exp empty cache of cap 4")
+}
@@ -0,0 +1,57 @@
+// context.go - carrying a cache in a context
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve
+
+import (
+	"context"
+)
+
+// ctxKey is the context key for a cache; each instantiation is a
+// distinct type - so caches of different types don't collide.
+type ctxKey[K comparable, V any] struct{}
+
+// NewContext returns a copy of 'ctx' carrying the cache 's'; use
+// FromContext to retrieve it. This is handy for request scoped caches
+// that must be threaded through a call stack.
+func NewContext[K comparable, V any](ctx context.Context, s *Sieve[K, V]) context.Context {
+	return context.WithValue(ctx, ctxKey[K, V]{}, s)
+}
+
+// FromContext returns the cache of type Sieve[K, V] carried by 'ctx'
+// and true - or nil and false if there isn't one.
+func FromContext[K comparable, V any](ctx context.Context) (*Sieve[K, V], bool) {
+	s, ok := ctx.Value(ctxKey[K, V]{}).(*Sieve[K, V])
+	return s, ok && s != nil
+}
+
+// ContextGet fetches the value for 'key' from the cache carried by
+// 'ctx'; see Sieve.Get. If 'ctx' has no cache, it is a miss.
+func ContextGet[K comparable, V any](ctx context.Context, key K) (V, bool) {
+	if s, ok := FromContext[K, V](ctx); ok {
+		return s.Get(key)
+	}
+
+	var zero V
+	return zero, false
+}
+
+// ContextAdd adds 'key' to the cache carried by 'ctx'; see Sieve.Add.
+// If 'ctx' has no cache, it does nothing and returns false.
+func ContextAdd[K comparable, V any](ctx context.Context, key K, val V) bool {
+	if s, ok := FromContext[K, V](ctx); ok {
+		return s.Add(key, val)
+	}
+	return false
+}
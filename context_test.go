@@ -0,0 +1,57 @@
+// context_test.go -- tests for carrying a cache in a context
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opencoff/go-sieve"
+)
+
+func TestContext(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[string, int](8)
+	ctx := sieve.NewContext(context.Background(), s)
+
+	c, ok := sieve.FromContext[string, int](ctx)
+	assert(ok && c == s, "exp to get the cache back")
+
+	assert(!sieve.ContextAdd(ctx, "a", 1), "exp a to be new")
+	v, ok := sieve.ContextGet[string, int](ctx, "a")
+	assert(ok && v == 1, "exp a=1, saw %d %v", v, ok)
+	v, ok = s.Get("a")
+	assert(ok && v == 1, "exp a in the cache, saw %d %v", v, ok)
+
+	// a cache of another type isn't found
+	_, ok = sieve.FromContext[string, string](ctx)
+	assert(!ok, "exp no cache of another type")
+
+	// without a cache, the helpers do nothing
+	bare := context.Background()
+	_, ok = sieve.FromContext[string, int](bare)
+	assert(!ok, "exp no cache in a bare context")
+	assert(!sieve.ContextAdd(bare, "b", 2), "exp add to do nothing")
+	_, ok = sieve.ContextGet[string, int](bare, "b")
+	assert(!ok, "exp a miss without a cache")
+	assert(s.Len() == 1, "exp len 1, saw %d", s.Len())
+
+	// a nil cache counts as no cache
+	nilctx := sieve.NewContext[string, int](bare, nil)
+	_, ok = sieve.FromContext[string, int](nilctx)
+	assert(!ok, "exp nil cache to be absent")
+	assert(!sieve.ContextAdd(nilctx, "c", 3), "exp add to do nothing")
+}
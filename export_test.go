@@ -0,0 +1,36 @@
+// export_test.go - expose internals to the tests
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve
+
+// SkewSize corrupts the size of the cache by 'delta' - to exercise
+// the failure paths of Validate.
+func SkewSize[K comparable, V any](s *Sieve[K, V], delta int) {
+	s.mu.Lock()
+	s.size += delta
+	s.mu.Unlock()
+}
+
+// MakeCycle corrupts the list of the cache by linking its tail back
+// to its head - to check that diagnostics terminate.
+func MakeCycle[K comparable, V any](s *Sieve[K, V]) {
+	s.mu.Lock()
+	s.tail.next = s.head
+	s.mu.Unlock()
+}
+
+// SetByteHash replaces the key hash of 'b' - to force collisions.
+func SetByteHash(b *RawByteCache, hash func([]byte) uint64) {
+	b.hash = hash
+}
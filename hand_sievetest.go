@@ -0,0 +1,47 @@
+// hand_sievetest.go - test helpers to inspect and move the SIEVE hand
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+//go:build sievetest
+
+package sieve
+
+// HandKey returns the key the eviction hand points to and true; it
+// returns false if the hand isn't set (the next eviction starts at the
+// tail - or at the head with HandFromHead). This is only available
+// with the 'sievetest' build tag.
+func (s *Sieve[K, V]) HandKey() (K, bool) {
+	var k K
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reap()
+	if s.hand == nil {
+		return k, false
+	}
+	return s.hand.key, true
+}
+
+// SetHand moves the eviction hand to the entry for 'key'; the next
+// eviction starts its scan there. It returns false if the key is not
+// in the cache. This is only available with the 'sievetest' build tag.
+func (s *Sieve[K, V]) SetHand(key K) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.cache.Get(key)
+	if ok {
+		s.hand = n
+	}
+	return ok
+}
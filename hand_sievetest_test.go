@@ -0,0 +1,54 @@
+// hand_sievetest_test.go - tests for the hand test helpers
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+//go:build sievetest
+
+package sieve_test
+
+import (
+	"testing"
+
+	"github.com/opencoff/go-sieve"
+)
+
+func TestSetHand(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](4)
+	for i := 0; i < 4; i++ {
+		s.Add(i, i)
+	}
+
+	_, ok := s.HandKey()
+	assert(!ok, "exp hand to be unset")
+
+	// the hand moves from tail (0) toward head (3); so pointing it
+	// at 2 - after visiting 2 - makes 3 the next victim.
+	s.Get(2)
+	ok = s.SetHand(2)
+	assert(ok, "exp SetHand to succeed")
+	k, ok := s.HandKey()
+	assert(ok && k == 2, "exp hand at 2, saw %d %v", k, ok)
+
+	s.Add(10, 10)
+	_, ok = s.Get(3)
+	assert(!ok, "exp 3 to be evicted")
+	for _, k := range []int{0, 1, 2, 10} {
+		_, ok = s.Get(k)
+		assert(ok, "%d: exp to be present", k)
+	}
+
+	ok = s.SetHand(100)
+	assert(!ok, "exp SetHand to fail on absent key")
+}
@@ -0,0 +1,64 @@
+// inspect.go - read-only snapshot of the cache internals
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve
+
+// State is a point-in-time snapshot of the internals of a cache; it is
+// meant for tests that need to assert the eviction state of the cache.
+// Head, Tail and Hand are zero values when the cache is empty or (for
+// Hand) when the hand isn't set.
+type State[K comparable] struct {
+	Size     int
+	Capacity int
+
+	// Head is the most recently inserted key, Tail the oldest
+	Head K
+	Tail K
+
+	// Hand is the key where the next eviction scan starts; if HasHand
+	// is false, the scan starts at Tail - or at Head if the cache was
+	// created with HandFromHead.
+	Hand    K
+	HasHand bool
+
+	// Visited maps every key in the cache to its visited bit
+	Visited map[K]bool
+}
+
+// Inspect returns a snapshot of the cache internals taken under the
+// cache lock. Modifying the returned State doesn't affect the cache.
+func (s *Sieve[K, V]) Inspect() State[K] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reap()
+
+	st := State[K]{
+		Size:     s.size,
+		Capacity: s.capacity,
+		Visited:  make(map[K]bool, s.size),
+	}
+
+	if s.head != nil {
+		st.Head = s.head.key
+		st.Tail = s.tail.key
+	}
+	if s.hand != nil {
+		st.Hand = s.hand.key
+		st.HasHand = true
+	}
+	for n, i := s.head, 0; n != nil && i < s.size; n, i = n.next, i+1 {
+		st.Visited[n.key] = n.visited.Load()
+	}
+	return st
+}
@@ -0,0 +1,56 @@
+// inspect_test.go -- tests for Inspect
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve_test
+
+import (
+	"testing"
+
+	"github.com/opencoff/go-sieve"
+)
+
+func TestInspect(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](3)
+	st := s.Inspect()
+	assert(st.Size == 0 && st.Capacity == 3, "empty: %+v", st)
+	assert(!st.HasHand && len(st.Visited) == 0, "empty: %+v", st)
+
+	s.Add(1, 1)
+	s.Add(2, 2)
+	s.Add(3, 3)
+	s.Get(1)
+
+	st = s.Inspect()
+	assert(st.Size == 3, "exp size 3, saw %d", st.Size)
+	assert(st.Head == 3 && st.Tail == 1, "exp head 3, tail 1; saw %d, %d", st.Head, st.Tail)
+	assert(!st.HasHand, "exp no hand before eviction")
+	assert(st.Visited[1] && !st.Visited[2] && !st.Visited[3], "visited: %v", st.Visited)
+
+	// 1 is visited, so the hand clears it and evicts 2
+	s.Add(4, 4)
+
+	st = s.Inspect()
+	assert(st.Size == 3, "exp size 3, saw %d", st.Size)
+	assert(st.Head == 4 && st.Tail == 1, "exp head 4, tail 1; saw %d, %d", st.Head, st.Tail)
+	assert(st.HasHand && st.Hand == 3, "exp hand at 3; saw %+v", st)
+	_, ok := st.Visited[2]
+	assert(!ok, "2 should've been evicted: %v", st.Visited)
+	assert(!st.Visited[1], "1 should've been cleared: %v", st.Visited)
+
+	// the snapshot is a copy
+	st.Visited[4] = true
+	assert(!s.Inspect().Visited[4], "snapshot aliases the cache")
+}
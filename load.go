@@ -0,0 +1,56 @@
+// load.go - streaming warm up of the cache
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// LoadStream warms up the cache from the serialized entries in 'r' -
+// one entry at a time; so the stream needn't fit in memory. 'decode'
+// reads the next entry and returns its key, value and visited flag;
+// it returns io.EOF at the end of the stream. The entries are
+// expected in the order they'd have been added (oldest first) and are
+// added just like Add - evicting as needed once the cache is full.
+// The cache lock isn't held while decoding.
+//
+// LoadStream returns the number of entries added and the first error
+// from 'decode' other than io.EOF.
+func (s *Sieve[K, V]) LoadStream(r io.Reader, decode func(*bufio.Reader) (K, V, bool, error)) (int, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	var n int
+	for {
+		key, val, visited, err := decode(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return n, err
+		}
+
+		s.mu.Lock()
+		x := s.add(key, val)
+		x.visited.Store(visited)
+		s.trim()
+		s.unlock()
+		n++
+	}
+}
@@ -0,0 +1,85 @@
+// load_test.go -- tests for streaming warm up
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/opencoff/go-sieve"
+)
+
+// decodeEntry reads a <key, val, visited> record of two uvarints and
+// a byte
+func decodeEntry(r *bufio.Reader) (uint64, uint64, bool, error) {
+	k, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	v, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, 0, false, io.ErrUnexpectedEOF
+	}
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, false, io.ErrUnexpectedEOF
+	}
+	return k, v, b == 1, nil
+}
+
+func encodeEntries(n int) []byte {
+	var buf []byte
+	for i := 0; i < n; i++ {
+		buf = binary.AppendUvarint(buf, uint64(i))
+		buf = binary.AppendUvarint(buf, uint64(i*10))
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+func TestLoadStream(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[uint64, uint64](64)
+	n, err := s.LoadStream(bytes.NewReader(encodeEntries(50)), decodeEntry)
+	assert(err == nil, "load: %v", err)
+	assert(n == 50 && s.Len() == 50, "exp 50 entries, saw %d %d", n, s.Len())
+	for i := uint64(0); i < 50; i++ {
+		v, ok := s.Get(i)
+		assert(ok && v == i*10, "%d: exp %d, saw %d %v", i, i*10, v, ok)
+	}
+
+	// a stream larger than the cache keeps the newest entries
+	s = sieve.New[uint64, uint64](64)
+	n, err = s.LoadStream(bytes.NewReader(encodeEntries(1000)), decodeEntry)
+	assert(err == nil, "load: %v", err)
+	assert(n == 1000 && s.Len() == 64, "exp 64 of 1000 entries, saw %d %d", n, s.Len())
+	for i := uint64(1000 - 64); i < 1000; i++ {
+		_, ok := s.Get(i)
+		assert(ok, "%d: exp to be present", i)
+	}
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+
+	// a truncated stream stops at the bad record
+	blob := encodeEntries(10)
+	s = sieve.New[uint64, uint64](64)
+	n, err = s.LoadStream(bytes.NewReader(blob[:len(blob)-1]), decodeEntry)
+	assert(errors.Is(err, io.ErrUnexpectedEOF), "exp unexpected EOF, saw %v", err)
+	assert(n == 9 && s.Len() == 9, "exp 9 entries, saw %d %d", n, s.Len())
+}
@@ -0,0 +1,81 @@
+// meta.go - cache of values with an attached metadata slot
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve
+
+// ValueMeta is a value and its metadata as stored by SieveMeta
+type ValueMeta[V any, M any] struct {
+	Value V
+	Meta  M
+}
+
+// SieveMeta is a cache that stores a small metadata blob (e.g., an
+// etag) alongside each value - without wrapping the value in a struct
+// at every call site.
+type SieveMeta[K comparable, V any, M any] struct {
+	s *Sieve[K, ValueMeta[V, M]]
+}
+
+// NewMeta creates a new cache of size 'capacity' mapping key 'K' to a
+// value 'V' and its metadata 'M' - configured by the given options.
+func NewMeta[K comparable, V any, M any](capacity int, opts ...Option[K, ValueMeta[V, M]]) *SieveMeta[K, V, M] {
+	m := &SieveMeta[K, V, M]{
+		s: NewWithOptions[K, ValueMeta[V, M]](capacity, opts...),
+	}
+	return m
+}
+
+// Get fetches the value and metadata for 'key'; see Sieve.Get
+func (m *SieveMeta[K, V, M]) Get(key K) (V, M, bool) {
+	vm, ok := m.s.Get(key)
+	return vm.Value, vm.Meta, ok
+}
+
+// Add adds or replaces the value and metadata for 'key'; see Sieve.Add
+func (m *SieveMeta[K, V, M]) Add(key K, val V, meta M) bool {
+	return m.s.Add(key, ValueMeta[V, M]{val, meta})
+}
+
+// Probe adds 'val' and 'meta' for 'key' if it isn't in the cache; see
+// Sieve.Probe
+func (m *SieveMeta[K, V, M]) Probe(key K, val V, meta M) (V, M, bool) {
+	vm, ok := m.s.Probe(key, ValueMeta[V, M]{val, meta})
+	return vm.Value, vm.Meta, ok
+}
+
+// Delete deletes 'key' from the cache; see Sieve.Delete
+func (m *SieveMeta[K, V, M]) Delete(key K) bool {
+	return m.s.Delete(key)
+}
+
+// Len returns the number of entries in the cache
+func (m *SieveMeta[K, V, M]) Len() int {
+	return m.s.Len()
+}
+
+// Cap returns the capacity of the cache
+func (m *SieveMeta[K, V, M]) Cap() int {
+	return m.s.Cap()
+}
+
+// Purge removes all the entries from the cache
+func (m *SieveMeta[K, V, M]) Purge() {
+	m.s.Purge()
+}
+
+// Sieve returns the underlying cache of ValueMeta pairs - for the
+// operations not wrapped by SieveMeta.
+func (m *SieveMeta[K, V, M]) Sieve() *Sieve[K, ValueMeta[V, M]] {
+	return m.s
+}
@@ -0,0 +1,54 @@
+// meta_test.go -- tests for the cache with metadata
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve_test
+
+import (
+	"testing"
+
+	"github.com/opencoff/go-sieve"
+)
+
+func TestMeta(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.NewMeta[string, []byte, string](2)
+
+	assert(!s.Add("a", []byte("alpha"), "etag-1"), "exp insert of new key")
+	v, m, ok := s.Get("a")
+	assert(ok && string(v) == "alpha" && m == "etag-1", "exp alpha/etag-1, saw %s %s %v", v, m, ok)
+
+	// replacing updates both
+	assert(s.Add("a", []byte("ALPHA"), "etag-2"), "exp replace")
+	v, m, _ = s.Get("a")
+	assert(string(v) == "ALPHA" && m == "etag-2", "exp ALPHA/etag-2, saw %s %s", v, m)
+
+	v, m, ok = s.Probe("a", []byte("x"), "x")
+	assert(ok && string(v) == "ALPHA" && m == "etag-2", "exp probe hit, saw %s %s %v", v, m, ok)
+	v, m, ok = s.Probe("b", []byte("beta"), "etag-3")
+	assert(!ok && string(v) == "beta" && m == "etag-3", "exp probe insert, saw %s %s %v", v, m, ok)
+
+	// eviction drops value and metadata together
+	s.Add("c", []byte("gamma"), "etag-4")
+	assert(s.Len() == 2, "exp 2 entries, saw %d", s.Len())
+	_, m, ok = s.Get("b")
+	assert(!ok && m == "", "exp b evicted, saw %q %v", m, ok)
+
+	e, ok := s.Sieve().GetEntry("c")
+	assert(ok && e.Value.Meta == "etag-4", "exp etag-4 via the underlying cache")
+
+	assert(s.Delete("a"), "exp delete")
+	s.Purge()
+	assert(s.Len() == 0 && s.Cap() == 2, "exp empty cache of cap 2")
+}
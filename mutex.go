@@ -0,0 +1,27 @@
+// mutex.go - the cache lock
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+//go:build !sievetest
+
+package sieve
+
+import (
+	"sync"
+)
+
+// mutex is the cache lock. Builds with the 'sievetest' tag replace it
+// with one that panics when a callback re-enters the cache.
+type mutex struct {
+	sync.Mutex
+}
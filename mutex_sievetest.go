@@ -0,0 +1,63 @@
+// mutex_sievetest.go - cache lock that detects reentrant calls
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+//go:build sievetest
+
+package sieve
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// mutex is the cache lock; it remembers the goroutine holding it and
+// panics if that goroutine tries to take it again - i.e., if a
+// callback that runs with the lock held calls back into the cache.
+// Without this, such a call deadlocks. This is only available with
+// the 'sievetest' build tag.
+type mutex struct {
+	sync.Mutex
+	owner atomic.Int64
+}
+
+func (m *mutex) Lock() {
+	id := goid()
+	if m.owner.Load() == id {
+		panic("sieve: reentrant call into the cache from a callback")
+	}
+	m.Mutex.Lock()
+	m.owner.Store(id)
+}
+
+func (m *mutex) Unlock() {
+	m.owner.Store(0)
+	m.Mutex.Unlock()
+}
+
+// goid returns the id of the current goroutine
+func goid() int64 {
+	var buf [64]byte
+
+	// the stack trace starts with "goroutine <id> [running]:"
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
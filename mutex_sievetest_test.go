@@ -0,0 +1,59 @@
+// mutex_sievetest_test.go -- tests for detecting reentrant calls
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+//go:build sievetest
+
+package sieve_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opencoff/go-sieve"
+)
+
+func TestReentrantPanics(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](4)
+
+	var err any
+	func() {
+		defer func() {
+			err = recover()
+		}()
+		s.GetOrAddFunc(1, func(k int) int {
+			s.Add(2, 2)
+			return k
+		})
+	}()
+	msg, _ := err.(string)
+	assert(strings.Contains(msg, "reentrant"), "exp reentrant panic, saw %v", err)
+
+	// other goroutines just wait for the lock
+	p := sieve.New[int, int](4)
+	done := make(chan struct{})
+	v, added := p.GetOrAddFunc(1, func(k int) int {
+		go func() {
+			p.Add(2, 2)
+			close(done)
+		}()
+		return k
+	})
+	<-done
+	assert(added && v == 1, "exp 1 to be added, saw %d %v", v, added)
+	_, ok := p.Get(2)
+	assert(ok, "exp 2 to be added")
+	assert(p.Validate() == nil, "invariants: %v", p.Validate())
+}
@@ -0,0 +1,77 @@
+// namespace.go - namespaced views sharing one cache
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SieveView is a namespace in a cache keyed by strings: its keys are
+// stored with a prefix unique to the namespace - so lookups are
+// isolated from other namespaces; but all the namespaces share the
+// capacity of the underlying cache and SIEVE evicts across all of
+// them.
+type SieveView[V any] struct {
+	s      *Sieve[string, V]
+	prefix string
+}
+
+// Namespace returns a view of 's' scoped to the namespace 'ns'. Views
+// of the same namespace share their entries. Keys added directly to
+// 's' are in no namespace.
+func Namespace[V any](s *Sieve[string, V], ns string) *SieveView[V] {
+	// length prefix the namespace; so no two namespaces' keys collide
+	v := &SieveView[V]{
+		s:      s,
+		prefix: strconv.Itoa(len(ns)) + ":" + ns,
+	}
+	return v
+}
+
+// Get fetches the value for 'key' in the namespace; see Sieve.Get
+func (v *SieveView[V]) Get(key string) (V, bool) {
+	return v.s.Get(v.prefix + key)
+}
+
+// Add adds or replaces the value for 'key' in the namespace; see
+// Sieve.Add
+func (v *SieveView[V]) Add(key string, val V) bool {
+	return v.s.Add(v.prefix+key, val)
+}
+
+// Probe adds 'val' for 'key' in the namespace if it isn't in the
+// cache; see Sieve.Probe
+func (v *SieveView[V]) Probe(key string, val V) (V, bool) {
+	return v.s.Probe(v.prefix+key, val)
+}
+
+// Delete deletes 'key' from the namespace; see Sieve.Delete
+func (v *SieveView[V]) Delete(key string) bool {
+	return v.s.Delete(v.prefix + key)
+}
+
+// Purge deletes all the entries in the namespace and returns their
+// count. It walks the entire underlying cache.
+func (v *SieveView[V]) Purge() int {
+	return v.s.DeleteMatching(func(k string) bool {
+		return strings.HasPrefix(k, v.prefix)
+	})
+}
+
+// Sieve returns the underlying cache shared by all the namespaces
+func (v *SieveView[V]) Sieve() *Sieve[string, V] {
+	return v.s
+}
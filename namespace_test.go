@@ -0,0 +1,67 @@
+// namespace_test.go -- tests for namespaced views
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve_test
+
+import (
+	"testing"
+
+	"github.com/opencoff/go-sieve"
+)
+
+func TestNamespace(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[string, int](4)
+	a := sieve.Namespace(s, "a")
+	b := sieve.Namespace(s, "b")
+
+	a.Add("x", 1)
+	b.Add("x", 2)
+	v, ok := a.Get("x")
+	assert(ok && v == 1, "exp 1 in a, saw %d %v", v, ok)
+	v, ok = b.Get("x")
+	assert(ok && v == 2, "exp 2 in b, saw %d %v", v, ok)
+	_, ok = s.Get("x")
+	assert(!ok, "exp x to not be in the root namespace")
+
+	// namespaces whose names and keys concatenate the same don't
+	// collide
+	ab := sieve.Namespace(s, "ab")
+	ab.Add("c", 3)
+	a.Add("bc", 4)
+	v, _ = ab.Get("c")
+	assert(v == 3, "exp 3 in ab, saw %d", v)
+
+	// the capacity is shared: filling b evicts from a
+	assert(s.Len() == 4, "exp a full cache, saw %d", s.Len())
+	b.Get("x")
+	b.Add("y", 5)
+	b.Add("z", 6)
+	_, ok = a.Get("x")
+	assert(!ok, "exp a/x to be evicted by b's adds")
+	assert(s.Len() == 4, "exp 4 entries, saw %d", s.Len())
+
+	v, ok = b.Probe("y", 50)
+	assert(ok && v == 5, "exp probe hit in b, saw %d %v", v, ok)
+	assert(!a.Delete("y"), "exp no y in a")
+	assert(b.Delete("y"), "exp to delete y from b")
+
+	n := b.Purge()
+	assert(n == 2, "exp to purge 2 entries from b, saw %d", n)
+	_, ok = b.Get("x")
+	assert(!ok, "exp b to be empty")
+	assert(b.Sieve() == s, "exp the shared cache")
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
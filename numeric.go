@@ -0,0 +1,52 @@
+// numeric.go - helpers for caches with numeric values
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve
+
+// Number is a constraint for the numeric value types
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Increment atomically adds 'delta' to the value of 'key' and returns
+// the new value. If the key is not in the cache, it is added with the
+// value 'delta'.
+func Increment[K comparable, V Number](s *Sieve[K, V], key K, delta V) V {
+	v, _ := s.Compute(key, func(old V, _ bool) (V, bool) {
+		return old + delta, true
+	})
+	return v
+}
+
+// Sum returns the total of all the values in the cache; it is useful
+// for caches of counters (see Increment). Sum doesn't mark the entries
+// as visited.
+func Sum[K comparable, V Number](s *Sieve[K, V]) V {
+	var sum V
+
+	s.mu.Lock()
+	s.reap()
+	for n, i := s.head, 0; n != nil && i < s.size; n, i = n.next, i+1 {
+		if s.expired(n) {
+			continue
+		}
+		n.mu.Lock()
+		sum += n.val
+		n.mu.Unlock()
+	}
+	s.mu.Unlock()
+	return sum
+}
@@ -0,0 +1,78 @@
+// numeric_test.go - tests for numeric helpers
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/opencoff/go-sieve"
+)
+
+func TestIncrement(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[string, int64](16)
+
+	v := sieve.Increment(s, "a", 5)
+	assert(v == 5, "exp 5 on absent key, saw %d", v)
+	v = sieve.Increment(s, "a", -2)
+	assert(v == 3, "exp 3, saw %d", v)
+
+	var wg sync.WaitGroup
+
+	ncpu := 16
+	iter := 1000
+	wg.Add(ncpu)
+	for i := 0; i < ncpu; i++ {
+		go func() {
+			for j := 0; j < iter; j++ {
+				sieve.Increment(s, "ctr", 1)
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	v, ok := s.Get("ctr")
+	assert(ok, "exp ctr to be present")
+	assert(v == int64(ncpu*iter), "exp %d, saw %d", ncpu*iter, v)
+}
+
+func TestSum(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, float64](8)
+	assert(sieve.Sum(s) == 0, "exp 0 for an empty cache")
+
+	var exp float64
+	for i := 1; i <= 5; i++ {
+		v := float64(i) * 1.5
+		s.Add(i, v)
+		exp += v
+	}
+	sieve.Increment(s, 1, 2)
+	exp += 2
+	assert(sieve.Sum(s) == exp, "exp %f, saw %f", exp, sieve.Sum(s))
+
+	s.Delete(3)
+	exp -= 4.5
+	assert(sieve.Sum(s) == exp, "exp %f after delete, saw %f", exp, sieve.Sum(s))
+
+	c := sieve.New[string, uint8](4)
+	sieve.Increment(c, "a", 3)
+	sieve.Increment(c, "b", 4)
+	assert(sieve.Sum(c) == 7, "exp 7, saw %d", sieve.Sum(c))
+}
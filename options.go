@@ -0,0 +1,380 @@
+// options.go - functional options for configuring the cache
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve
+
+import (
+	"fmt"
+	"time"
+)
+
+// Option configures optional behavior of a cache created with
+// NewWithOptions.
+type Option[K comparable, V any] func(s *Sieve[K, V])
+
+// NewWithOptions creates a new cache of size 'capacity' mapping key 'K'
+// to value 'V' - and configured by the given options.
+func NewWithOptions[K comparable, V any](capacity int, opts ...Option[K, V]) *Sieve[K, V] {
+	s := New[K, V](capacity)
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// WithHitCount tracks the number of hits seen by each key (see TopN
+// and GetEntry).
+func WithHitCount[K comparable, V any]() Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.countHits = true
+	}
+}
+
+// WithInsertMode sets where new entries are inserted in the cache.
+func WithInsertMode[K comparable, V any](mode InsertMode) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.insertAtTail = mode == InsertAtTail
+	}
+}
+
+// WithPolicy selects the eviction policy; the default is PolicySieve.
+func WithPolicy[K comparable, V any](p Policy) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.policy = p
+	}
+}
+
+// WithHandStart selects where the eviction hand starts and the
+// direction in which it moves; the default is HandFromTail. The best
+// choice depends on the workload.
+func WithHandStart[K comparable, V any](h HandStart) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.handHead = h == HandFromHead
+	}
+}
+
+// WithFullPolicy selects what happens when a new key is added to a
+// full cache; the default is FullEvict. FullReject is only honored by
+// Add, AddWithTTL, AddWeighted, TryAdd and Probe; the compute and bulk
+// adds (GetOrAddFunc, Compute, Preload, AddMany etc.) always evict.
+func WithFullPolicy[K comparable, V any](p FullPolicy) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.reject = p == FullReject
+	}
+}
+
+// WithProbeNoBoost stops Probe from marking the entries it finds as
+// visited; this keeps existence checks on a write path from protecting
+// entries that aren't otherwise read. Inserts by Probe are unaffected.
+func WithProbeNoBoost[K comparable, V any]() Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.probeNoBoost = true
+	}
+}
+
+// WithTombstones makes Delete and DeleteMulti tombstone the entries:
+// a deleted entry is removed from the index at once - so it is
+// invisible to lookups - but its list node is unlinked and reused
+// later: by the next eviction, by Compact or by any call that walks
+// the cache. This moves the list maintenance off the delete path;
+// until then, the tombstones hold on to their (zeroed) nodes. The
+// delete callbacks are called when the entry is tombstoned.
+func WithTombstones[K comparable, V any]() Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.tombstones = true
+	}
+}
+
+// WithSizer tracks the approximate bytes cached (Stats.BytesCached);
+// 'sizer' returns the size in bytes of a given entry.
+func WithSizer[K comparable, V any](sizer func(K, V) int64) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.sizer = sizer
+	}
+}
+
+// WithWeigher bounds the cache by the total weight of its entries in
+// addition to the number of entries. 'weigher' returns the weight of
+// an entry; entries are evicted until the new entry fits within
+// 'maxWeight'. The total weight is reported in Stats.BytesCached; this
+// option replaces any sizer configured via WithSizer. Add stores an
+// entry heavier than 'maxWeight' as the only entry in the cache; use
+// AddWeighted to reject such entries instead.
+func WithWeigher[K comparable, V any](maxWeight int64, weigher func(K, V) int64) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.sizer = weigher
+		s.maxWeight = maxWeight
+	}
+}
+
+// WithAdaptive tunes the cache capacity between 'min' and 'max' to
+// keep the hit ratio close to 'target'. See NewAdaptive.
+func WithAdaptive[K comparable, V any](min, max int, target float64) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		if min < 1 {
+			min = 1
+		}
+		if max < min {
+			max = min
+		}
+
+		s.adapt = &adaptive{
+			min:    min,
+			max:    max,
+			target: target,
+		}
+		s.capacity = minmax(s.capacity, min, max)
+	}
+}
+
+// WithTTL sets the default time-to-live of entries added to the cache.
+// Expired entries are treated as absent and removed lazily - when they
+// are next accessed or evicted. Use AddWithTTL to override the TTL
+// of individual entries.
+func WithTTL[K comparable, V any](ttl time.Duration) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.ttl = ttl
+	}
+}
+
+// WithSlidingTTL is like WithTTL - but every hit on an entry (Get,
+// Probe etc.) extends its life by its TTL. Entries thus live as long
+// as they're being used. Entries added via AddWithTTL slide by their
+// own TTL.
+func WithSlidingTTL[K comparable, V any](ttl time.Duration) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.ttl = ttl
+		s.sliding = true
+	}
+}
+
+// Clock is a source of the current time; see WithClock
+type Clock interface {
+	Now() time.Time
+}
+
+// sysClock is the default Clock - the system time
+type sysClock struct{}
+
+func (sysClock) Now() time.Time {
+	return time.Now()
+}
+
+// WithClock makes the cache read the current time from 'c'; the
+// default is the system time.
+// The clock determines TTL expiry, entry ages and the RateStats
+// interval. This is mainly useful for tests that need to advance time
+// without sleeping.
+func WithClock[K comparable, V any](c Clock) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.clock = c
+		s.rates.at = c.Now()
+	}
+}
+
+// WithOnEvict calls 'fn' for every entry evicted to make room for new
+// entries. The callback runs after the cache lock is released; so it
+// can safely call back into the cache.
+func WithOnEvict[K comparable, V any](fn func(key K, val V)) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.onEvict = fn
+	}
+}
+
+// Cause is the reason an entry left the cache
+type Cause int
+
+const (
+	// CauseEvicted is an eviction to make room for new entries
+	CauseEvicted Cause = iota
+
+	// CauseDeleted is an explicit delete by the caller
+	CauseDeleted
+
+	// CauseExpired is the removal of an entry past its TTL
+	CauseExpired
+
+	// CausePurged is the removal of all entries by Purge
+	CausePurged
+)
+
+func (c Cause) String() string {
+	switch c {
+	case CauseEvicted:
+		return "evicted"
+	case CauseDeleted:
+		return "deleted"
+	case CauseExpired:
+		return "expired"
+	case CausePurged:
+		return "purged"
+	}
+	return fmt.Sprintf("Cause(%d)", int(c))
+}
+
+// WithOnRemove calls 'fn' for every entry that leaves the cache -
+// with the reason it left. Unlike WithOnEvict, this includes deletes,
+// expiry and purges; replacing the value of an entry isn't a removal.
+// Like WithOnEvict, the callback runs after the cache lock is
+// released. Both callbacks can be used together.
+func WithOnRemove[K comparable, V any](fn func(key K, val V, cause Cause)) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.onRemove = fn
+	}
+}
+
+// Observer is a set of callbacks tracing the lifecycle of the cache
+// entries; any of them may be nil. OnEvict is called for entries
+// evicted to make room and OnDelete for all the other removals -
+// deletes, expiry and purges. The callbacks run after the cache lock
+// is released; OnHit and OnMiss run on the lookup path - so they
+// must be cheap.
+type Observer[K comparable, V any] struct {
+	OnInsert func(key K, val V)
+	OnHit    func(key K)
+	OnMiss   func(key K)
+	OnEvict  func(key K, val V)
+	OnDelete func(key K, val V)
+}
+
+// WithObserver registers 'o' to observe the lifecycle of the entries.
+func WithObserver[K comparable, V any](o Observer[K, V]) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.obs = &o
+	}
+}
+
+// WithAutoClose calls Close on values that implement io.Closer when
+// they leave the cache - evicted, deleted, expired or purged. Like
+// WithOnRemove, Close is called after the cache lock is released; its
+// error is ignored. Values replaced by a new value for the same key
+// aren't closed: the caller may be re-adding the same value. Use
+// WithOnReplace to release those.
+func WithAutoClose[K comparable, V any]() Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.autoClose = true
+	}
+}
+
+// WithOnReplace calls 'fn' with the old and new value whenever the
+// value of an existing entry is replaced - by Add, CompareAndSwap,
+// Compute etc. This is useful to release resources held by the old
+// value; OnEvict and OnRemove aren't called for replacements. Like
+// those, the callback can safely call back into the cache.
+func WithOnReplace[K comparable, V any](fn func(key K, old, new V)) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.onReplace = fn
+	}
+}
+
+// EvictTrace describes one step of the eviction hand: the entry it
+// examined and what it decided.
+type EvictTrace[K comparable] struct {
+	// Key is the entry under the hand
+	Key K
+
+	// Visited is the entry's visited flag when the hand reached it;
+	// a visited entry is spared and its flag cleared.
+	Visited bool
+
+	// Evicted is true if the entry was chosen as the victim
+	Evicted bool
+
+	// Scan is the number of entries spared so far by this eviction
+	Scan int
+}
+
+// WithEvictTrace calls 'fn' for every entry examined by the eviction
+// hand - to help understand why a particular entry was evicted. 'fn'
+// is called with the cache lock held; it must not call back into the
+// cache. Without this option, tracing costs nothing but a nil check.
+func WithEvictTrace[K comparable, V any](fn func(t EvictTrace[K])) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.trace = fn
+	}
+}
+
+// WithValueCloner makes lookups return a copy of the cached value -
+// as returned by 'clone'. This protects the cached values of mutable
+// types (slices, maps, pointers) from callers that modify the values
+// they get from the cache.
+func WithValueCloner[K comparable, V any](clone func(V) V) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.clone = clone
+	}
+}
+
+// Recorder receives the latency of cache operations; it is typically
+// backed by a histogram in a metrics library.
+type Recorder interface {
+	// Observe is called with the name of the operation ("get",
+	// "add" or "delete") and its duration.
+	Observe(op string, d time.Duration)
+}
+
+// WithRecorder records the latency of Get, Add and Delete in 'rec'.
+// Caches without a recorder don't pay for timing the operations.
+func WithRecorder[K comparable, V any](rec Recorder) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.rec = rec
+	}
+}
+
+// WithHitWindow tracks the hit ratio over the last 'n' lookups (see
+// RecentHitRatio).
+func WithHitWindow[K comparable, V any](n int) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		if n > 0 {
+			s.window = newHitWindow(n)
+		}
+	}
+}
+
+// WithThrashing configures the thresholds of IsThrashing: the cache is
+// thrashing if - over each window of 'window' lookups - the hit ratio
+// is at most 'maxHitRatio' and there are at least 'minEvictRatio'
+// evictions per lookup.
+func WithThrashing[K comparable, V any](window int, maxHitRatio, minEvictRatio float64) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.thrash.window = uint64(max(window, 1))
+		s.thrash.maxHit = maxHitRatio
+		s.thrash.minEvict = minEvictRatio
+	}
+}
+
+// WithEvictBatch evicts 'n' entries at a time when the cache is full;
+// the next n-1 inserts then proceed without evicting. This amortizes
+// the cost of the eviction scan over several inserts - at the cost of
+// the cache transiently holding up to n-1 fewer entries than its
+// capacity. 'n' is clamped to [1, capacity].
+func WithEvictBatch[K comparable, V any](n int) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.batch = minmax(n, 1, s.capacity)
+	}
+}
+
+// WithAutoGrow doubles the capacity of a full cache - up to 'max' -
+// instead of evicting an entry to make room for a new one. Once the
+// capacity reaches 'max', the cache evicts as usual. A 'max' below the
+// initial capacity disables growth.
+func WithAutoGrow[K comparable, V any](max int) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.growMax = max
+	}
+}
+
+// minmax clamps 'v' to the range [lo, hi]
+func minmax(v, lo, hi int) int {
+	return min(max(v, lo), hi)
+}
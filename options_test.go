@@ -0,0 +1,1172 @@
+// options_test.go - tests for cache options
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencoff/go-sieve"
+)
+
+func TestOptionsDefault(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.NewWithOptions[int, int](4)
+	for i := 0; i < 8; i++ {
+		s.Add(i, i)
+	}
+	assert(s.Len() == 4, "exp 4 entries, saw %d", s.Len())
+	assert(s.Cap() == 4, "exp cap 4, saw %d", s.Cap())
+}
+
+func TestOptionsOnEvict(t *testing.T) {
+	assert := newAsserter(t)
+
+	var evicted []int
+	s := sieve.NewWithOptions[int, string](4,
+		sieve.WithOnEvict(func(k int, v string) {
+			evicted = append(evicted, k)
+		}),
+		sieve.WithHitCount[int, string](),
+	)
+
+	for i := 0; i < 4; i++ {
+		s.Add(i, "x")
+	}
+	s.Get(0)
+	s.Get(0)
+	s.Add(4, "y")
+	s.Add(5, "z")
+
+	// deletes aren't evictions
+	s.Delete(4)
+
+	exp := []int{1, 2}
+	assert(len(evicted) == len(exp), "exp %d evictions, saw %v", len(exp), evicted)
+	for i := range exp {
+		assert(evicted[i] == exp[i], "%d: exp %d, saw %d", i, exp[i], evicted[i])
+	}
+
+	top := s.TopN(1)
+	assert(len(top) == 1 && top[0].Key == 0 && top[0].Hits == 2, "wrong top keys %v", top)
+}
+
+func TestOptionsTTL(t *testing.T) {
+	assert := newAsserter(t)
+
+	var evicted int
+	ttl := 20 * time.Millisecond
+	clk := newFakeClock()
+	s := sieve.NewWithOptions[int, int](4,
+		sieve.WithClock[int, int](clk),
+		sieve.WithTTL[int, int](ttl),
+		sieve.WithOnEvict(func(k, v int) {
+			evicted++
+		}),
+	)
+
+	s.Add(1, 1)
+	s.AddWithTTL(2, 2, 0)
+	s.AddWithTTL(3, 3, time.Hour)
+
+	_, ok := s.Get(1)
+	assert(ok, "exp 1 to be live")
+
+	clk.Advance(2 * ttl)
+
+	_, ok = s.Get(1)
+	assert(!ok, "exp 1 to expire")
+	_, ok = s.Get(2)
+	assert(ok, "exp 2 to never expire")
+	_, ok = s.Get(3)
+	assert(ok, "exp 3 to be live")
+	assert(s.Len() == 2, "exp expired entry to be removed; len %d", s.Len())
+	assert(evicted == 0, "expiry isn't eviction; saw %d", evicted)
+
+	// Probe on an expired key inserts afresh
+	s.AddWithTTL(4, 4, time.Millisecond)
+	clk.Advance(2 * time.Millisecond)
+	v, ok := s.Probe(4, 40)
+	assert(!ok && v == 40, "exp probe to re-add expired key; saw %d %v", v, ok)
+}
+
+func TestOptionsWeigher(t *testing.T) {
+	assert := newAsserter(t)
+
+	var evicted []string
+	weigher := func(k string, v []byte) int64 {
+		return int64(len(v))
+	}
+	s := sieve.NewWithOptions[string, []byte](100,
+		sieve.WithWeigher(100, weigher),
+		sieve.WithOnEvict(func(k string, v []byte) {
+			evicted = append(evicted, k)
+		}),
+	)
+
+	s.Add("a", make([]byte, 40))
+	s.Add("b", make([]byte, 40))
+	assert(s.Stats().BytesCached == 80, "exp 80 bytes, saw %d", s.Stats().BytesCached)
+
+	// "a" must be evicted to make room
+	s.Add("c", make([]byte, 40))
+	assert(len(evicted) == 1 && evicted[0] == "a", "exp 'a' evicted, saw %v", evicted)
+	assert(s.Len() == 2, "exp 2 entries, saw %d", s.Len())
+	assert(s.Stats().BytesCached == 80, "exp 80 bytes, saw %d", s.Stats().BytesCached)
+
+	// growing a value beyond the budget evicts others
+	s.Add("c", make([]byte, 90))
+	assert(s.Stats().BytesCached <= 100, "exceeded budget: %d", s.Stats().BytesCached)
+	_, ok := s.Get("c")
+	assert(ok, "exp 'c' to be present")
+}
+
+func TestOptionsWeigherOversized(t *testing.T) {
+	assert := newAsserter(t)
+
+	weigher := func(k string, v []byte) int64 {
+		return int64(len(v))
+	}
+	s := sieve.NewWithOptions[string, []byte](100, sieve.WithWeigher(100, weigher))
+
+	s.Add("a", make([]byte, 40))
+	s.Add("b", make([]byte, 40))
+
+	ok := s.AddWeighted("c", make([]byte, 101))
+	assert(!ok, "exp oversized entry to be rejected")
+	assert(s.Len() == 2, "exp cache unchanged, saw %d entries", s.Len())
+	assert(s.Stats().BytesCached == 80, "exp 80 bytes, saw %d", s.Stats().BytesCached)
+	_, ok = s.Get("c")
+	assert(!ok, "exp 'c' to be absent")
+
+	// rejecting a replacement keeps the old value
+	ok = s.AddWeighted("a", make([]byte, 200))
+	assert(!ok, "exp oversized replacement to be rejected")
+	v, _ := s.Get("a")
+	assert(len(v) == 40, "exp old value of 'a', saw %d bytes", len(v))
+
+	ok = s.AddWeighted("c", make([]byte, 100))
+	assert(ok, "exp entry at the budget to fit")
+	assert(s.Len() == 1, "exp 'c' to be the only entry, saw %d", s.Len())
+
+	// plain Add keeps an oversized entry as the sole entry
+	s.Add("d", make([]byte, 150))
+	assert(s.Len() == 1, "exp one entry, saw %d", s.Len())
+	_, ok = s.Get("d")
+	assert(ok, "exp 'd' to be present")
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+
+	// a full cache that rejects new keys rejects them here too
+	r := sieve.NewWithOptions[string, []byte](1,
+		sieve.WithWeigher(100, weigher),
+		sieve.WithFullPolicy[string, []byte](sieve.FullReject))
+	ok = r.AddWeighted("a", make([]byte, 10))
+	assert(ok, "exp 'a' to be stored")
+	ok = r.AddWeighted("b", make([]byte, 10))
+	assert(!ok, "exp 'b' to be rejected by a full cache")
+	_, ok = r.Get("b")
+	assert(!ok, "exp 'b' to be absent")
+	ok = r.AddWeighted("a", make([]byte, 20))
+	assert(ok, "exp replacing 'a' to succeed")
+}
+
+func TestOptionsCombined(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.NewWithOptions[int, int](64,
+		sieve.WithInsertMode[int, int](sieve.InsertAtTail),
+		sieve.WithSizer(func(k, v int) int64 { return 8 }),
+		sieve.WithTTL[int, int](time.Hour),
+		sieve.WithAdaptive[int, int](16, 128, 0.9),
+	)
+
+	assert(s.Cap() == 64, "exp cap 64, saw %d", s.Cap())
+	for i := 0; i < 200; i++ {
+		s.Probe(i, i)
+	}
+	st := s.Stats()
+	assert(st.BytesCached == int64(8*s.Len()), "exp %d bytes, saw %d", 8*s.Len(), st.BytesCached)
+	assert(s.Len() <= s.Cap(), "len %d exceeds cap %d", s.Len(), s.Cap())
+}
+
+func TestOptionsValueCloner(t *testing.T) {
+	assert := newAsserter(t)
+
+	mutate := func(s *sieve.Sieve[int, []int]) []int {
+		s.Add(1, []int{1, 2, 3})
+
+		v, _ := s.Get(1)
+		v[0] = 100
+		v, _ = s.Probe(1, nil)
+		v[1] = 200
+
+		v, _ = s.Get(1)
+		return v
+	}
+
+	v := mutate(sieve.New[int, []int](4))
+	assert(v[0] == 100 && v[1] == 200, "exp shared value without cloner: %v", v)
+
+	clone := func(v []int) []int {
+		return append([]int(nil), v...)
+	}
+	v = mutate(sieve.NewWithOptions[int, []int](4, sieve.WithValueCloner[int](clone)))
+	assert(v[0] == 1 && v[1] == 2 && v[2] == 3, "exp intact value with cloner: %v", v)
+}
+
+func TestOptionsSlidingTTL(t *testing.T) {
+	assert := newAsserter(t)
+
+	ttl := 40 * time.Millisecond
+	clk := newFakeClock()
+	s := sieve.NewWithOptions[int, int](4,
+		sieve.WithClock[int, int](clk),
+		sieve.WithSlidingTTL[int, int](ttl))
+
+	s.Add(1, 1)
+	s.AddWithTTL(2, 2, ttl)
+
+	// keep accessing 1 well past its original deadline
+	for i := 0; i < 12; i++ {
+		_, ok := s.Get(1)
+		assert(ok, "exp 1 to live while in use; %d", i)
+		clk.Advance(ttl / 4)
+	}
+
+	_, ok := s.Get(2)
+	assert(!ok, "exp unused 2 to expire")
+
+	// and then expire once access stops
+	clk.Advance(2 * ttl)
+	_, ok = s.Get(1)
+	assert(!ok, "exp 1 to expire after access stops")
+
+	// fixed TTL doesn't slide
+	f := sieve.NewWithOptions[int, int](4,
+		sieve.WithClock[int, int](clk),
+		sieve.WithTTL[int, int](ttl))
+	f.Add(1, 1)
+	for i := 0; i < 3; i++ {
+		f.Get(1)
+		clk.Advance(ttl / 2)
+	}
+	_, ok = f.Get(1)
+	assert(!ok, "exp fixed TTL entry to expire")
+}
+
+func TestGetValid(t *testing.T) {
+	assert := newAsserter(t)
+
+	clk := newFakeClock()
+	s := sieve.NewWithOptions[int, int](4, sieve.WithClock[int, int](clk))
+	s.AddWithTTL(1, 10, time.Second)
+	s.AddWithTTL(2, 20, time.Minute)
+	s.Add(3, 30)
+
+	clk.Advance(2 * time.Second)
+	_, ok := s.GetValid(1)
+	assert(!ok, "exp 1 to have expired")
+	v, ok := s.GetValid(2)
+	assert(ok && v == 20, "exp 20 for 2, saw %d %v", v, ok)
+	v, ok = s.GetValid(3)
+	assert(ok && v == 30, "exp 30 for 3, saw %d %v", v, ok)
+
+	assert(s.Len() == 2, "exp expired entry to be removed, saw %d entries", s.Len())
+	st := s.Stats()
+	assert(st.Hits == 2 && st.Misses == 1, "exp 2 hits and 1 miss, saw %d %d", st.Hits, st.Misses)
+}
+
+func TestTouch(t *testing.T) {
+	assert := newAsserter(t)
+
+	clk := newFakeClock()
+	s := sieve.NewWithOptions[int, int](4, sieve.WithClock[int, int](clk))
+	s.AddWithTTL(1, 1, time.Hour)
+	s.AddWithTTL(2, 2, 10*time.Millisecond)
+
+	// shorten 1 and extend 2
+	ok := s.Touch(1, 10*time.Millisecond)
+	assert(ok, "exp touch on 1 to succeed")
+	ok = s.Touch(2, time.Hour)
+	assert(ok, "exp touch on 2 to succeed")
+	ok = s.Touch(3, time.Hour)
+	assert(!ok, "exp touch on absent key to fail")
+
+	clk.Advance(20 * time.Millisecond)
+
+	_, ok = s.Get(1)
+	assert(!ok, "exp 1 to expire early")
+	v, ok := s.Get(2)
+	assert(ok && v == 2, "exp 2 to outlive its original TTL")
+
+	// touching with 0 makes an entry permanent
+	s.AddWithTTL(5, 5, 5*time.Millisecond)
+	s.Touch(5, 0)
+	clk.Advance(10 * time.Millisecond)
+	_, ok = s.Get(5)
+	assert(ok, "exp 5 to never expire")
+}
+
+func TestOptionsClock(t *testing.T) {
+	assert := newAsserter(t)
+
+	clk := newFakeClock()
+	s := sieve.NewWithOptions[int, int](4,
+		sieve.WithClock[int, int](clk),
+		sieve.WithHitCount[int, int](),
+		sieve.WithTTL[int, int](time.Hour))
+
+	s.Add(1, 1)
+	s.AddWithTTL(2, 2, 2*time.Hour)
+
+	clk.Advance(time.Hour - time.Nanosecond)
+	_, ok := s.Get(1)
+	assert(ok, "exp 1 to be live just before its deadline")
+
+	// an hour passes instantly
+	clk.Advance(time.Nanosecond + 1)
+	_, ok = s.Get(1)
+	assert(!ok, "exp 1 to expire")
+	_, ok = s.Get(2)
+	assert(ok, "exp 2 to be live")
+
+	e, ok := s.GetEntry(2)
+	assert(ok && e.Age == time.Hour+1, "exp age 1h, saw %+v", e)
+}
+
+func TestOptionsTTLCompareAnd(t *testing.T) {
+	assert := newAsserter(t)
+
+	var causes []sieve.Cause
+	clk := newFakeClock()
+	s := sieve.NewWithOptions[int, int](4,
+		sieve.WithClock[int, int](clk),
+		sieve.WithTTL[int, int](time.Hour),
+		sieve.WithOnRemove[int, int](func(_, _ int, c sieve.Cause) {
+			causes = append(causes, c)
+		}))
+
+	s.Add(1, 1)
+	s.Add(2, 2)
+	s.Add(3, 3)
+	clk.Advance(30 * time.Minute)
+
+	// a swap refreshes the TTL
+	ok := sieve.CompareAndSwap(s, 3, 3, 30)
+	assert(ok, "exp CAS on a live entry")
+	clk.Advance(45 * time.Minute)
+
+	// expired entries are absent to CAS and CAD
+	ok = sieve.CompareAndSwap(s, 1, 1, 10)
+	assert(!ok, "exp CAS to fail on an expired entry")
+	_, ok = s.Get(1)
+	assert(!ok, "exp 1 to be absent")
+
+	ok = sieve.CompareAndDelete(s, 2, 2)
+	assert(!ok, "exp CAD to fail on an expired entry")
+	assert(fmt.Sprint(causes) == "[expired expired]", "exp expiry causes, saw %v", causes)
+
+	v, ok := s.Get(3)
+	assert(ok && v == 30, "exp 3 to outlive its first deadline, saw %d %v", v, ok)
+	assert(s.Len() == 1, "exp 1 entry, saw %d", s.Len())
+}
+
+func TestOptionsComputeReplace(t *testing.T) {
+	assert := newAsserter(t)
+
+	// replacing a value must keep within the weight budget
+	weigher := func(_, v int) int64 { return int64(v) }
+	s := sieve.NewWithOptions[int, int](8, sieve.WithWeigher(10, weigher))
+	s.Add(1, 3)
+	s.Add(2, 3)
+
+	v, ok := s.Compute(1, func(old int, _ bool) (int, bool) { return old * 3, true })
+	assert(ok && v == 9, "exp 9, saw %d %v", v, ok)
+	assert(s.Stats().BytesCached <= 10, "exceeded budget: %d", s.Stats().BytesCached)
+	v, ok = s.Get(1)
+	assert(ok && v == 9, "exp 1 to be kept, saw %d %v", v, ok)
+	assert(s.Len() == 1, "exp 2 to be evicted, saw %d entries", s.Len())
+
+	s.Add(2, 1)
+	s.AddMany([]sieve.Entry[int, int]{{Key: 2, Value: 8}})
+	assert(s.Stats().BytesCached <= 10, "exceeded budget: %d", s.Stats().BytesCached)
+
+	// and refreshes the TTL
+	clk := newFakeClock()
+	t1 := sieve.NewWithOptions[int, int](4,
+		sieve.WithClock[int, int](clk),
+		sieve.WithTTL[int, int](time.Hour))
+	t1.Add(1, 1)
+	clk.Advance(45 * time.Minute)
+	sieve.Increment(t1, 1, 1)
+	clk.Advance(45 * time.Minute)
+	v, ok = t1.Get(1)
+	assert(ok && v == 2, "exp 1 to outlive its first deadline, saw %d %v", v, ok)
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
+
+func TestOptionsTTLRekey(t *testing.T) {
+	assert := newAsserter(t)
+
+	clk := newFakeClock()
+	s := sieve.NewWithOptions[int, int](4,
+		sieve.WithClock[int, int](clk),
+		sieve.WithTTL[int, int](time.Hour))
+
+	s.Add(1, 1)
+	s.AddWithTTL(2, 2, 2*time.Hour)
+	s.AddWithTTL(3, 3, 2*time.Hour)
+	clk.Advance(90 * time.Minute)
+
+	// an expired source isn't moved
+	ok := s.Rekey(1, 10)
+	assert(!ok, "exp rekey of an expired key to fail")
+	_, ok = s.Get(10)
+	assert(!ok, "exp 10 to be absent")
+
+	// an expired destination doesn't block the move
+	s.AddWithTTL(4, 4, time.Minute)
+	clk.Advance(2 * time.Minute)
+	ok = s.Rekey(2, 4)
+	assert(ok, "exp rekey over an expired key")
+	v, ok := s.Get(4)
+	assert(ok && v == 2, "exp 4 to hold 2, saw %d %v", v, ok)
+
+	// a live destination does
+	ok = s.Rekey(3, 4)
+	assert(!ok, "exp rekey onto a live key to fail")
+	assert(s.Len() == 2, "exp 2 entries, saw %d", s.Len())
+}
+
+// fakeClock is a clock that only moves when advanced
+type fakeClock struct {
+	sync.Mutex
+	t time.Time
+}
+
+var _ sieve.Clock = (*fakeClock)(nil)
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Unix(1_000_000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.Lock()
+	c.t = c.t.Add(d)
+	c.Unlock()
+}
+
+type fakeRecorder struct {
+	sync.Mutex
+	ops map[string]int
+}
+
+func (r *fakeRecorder) Observe(op string, d time.Duration) {
+	r.Lock()
+	r.ops[op]++
+	r.Unlock()
+}
+
+func TestOptionsRecorder(t *testing.T) {
+	assert := newAsserter(t)
+
+	rec := &fakeRecorder{ops: make(map[string]int)}
+	s := sieve.NewWithOptions[int, int](4, sieve.WithRecorder[int, int](rec))
+
+	for i := 0; i < 3; i++ {
+		s.Add(i, i)
+	}
+	s.Get(0)
+	s.Get(100)
+	s.Delete(1)
+
+	exp := map[string]int{"add": 3, "get": 2, "delete": 1}
+	assert(len(rec.ops) == len(exp), "exp %d ops, saw %v", len(exp), rec.ops)
+	for op, n := range exp {
+		assert(rec.ops[op] == n, "%s: exp %d observations, saw %d", op, n, rec.ops[op])
+	}
+}
+
+func TestOptionsEvictBatch(t *testing.T) {
+	assert := newAsserter(t)
+
+	size := 64
+	s := sieve.NewWithOptions[int, int](size, sieve.WithEvictBatch[int, int](8))
+	for i := 0; i < size; i++ {
+		s.Add(i, i)
+	}
+	assert(s.Len() == size, "exp full cache, saw %d", s.Len())
+
+	// the first insert into a full cache evicts a batch
+	s.Add(1000, 1000)
+	assert(s.Len() == size-7, "exp len %d, saw %d", size-7, s.Len())
+	assert(s.Stats().Evictions == 8, "exp 8 evictions, saw %d", s.Stats().Evictions)
+
+	for i := 0; i < size*10; i++ {
+		s.Probe(2000+i, i)
+		assert(s.Len() <= size, "%d: len %d exceeds cap %d", i, s.Len(), size)
+	}
+}
+
+func TestOptionsProbeNoBoost(t *testing.T) {
+	assert := newAsserter(t)
+
+	// probe the oldest entry repeatedly, then overflow the cache
+	run := func(opts ...sieve.Option[int, int]) *sieve.Sieve[int, int] {
+		s := sieve.NewWithOptions[int, int](3, opts...)
+		s.Add(1, 1)
+		s.Add(2, 2)
+		s.Add(3, 3)
+		for i := 0; i < 4; i++ {
+			v, ok := s.Probe(1, 10)
+			assert(ok && v == 1, "probe: exp 1, saw %d %v", v, ok)
+		}
+		s.Add(4, 4)
+		return s
+	}
+
+	// by default, the probes protect 1 and 2 is evicted
+	s := run()
+	_, ok := s.Inspect().Visited[1]
+	assert(ok, "exp 1 to survive")
+	_, ok = s.Inspect().Visited[2]
+	assert(!ok, "exp 2 to be evicted")
+
+	// without the boost, 1 is evicted
+	s = run(sieve.WithProbeNoBoost[int, int]())
+	_, ok = s.Inspect().Visited[1]
+	assert(!ok, "exp 1 to be evicted")
+	assert(s.Stats().Hits == 4, "exp 4 hits, saw %d", s.Stats().Hits)
+
+	// inserts are unaffected
+	v, ok := s.Probe(5, 5)
+	assert(!ok && v == 5, "exp probe to insert 5; saw %d %v", v, ok)
+	v, ok = s.Get(5)
+	assert(ok && v == 5, "exp to find 5; saw %d %v", v, ok)
+}
+
+func TestOptionsOnRemove(t *testing.T) {
+	assert := newAsserter(t)
+
+	type removal struct {
+		key   int
+		cause sieve.Cause
+	}
+
+	var got []removal
+	var evicted []int
+	clk := newFakeClock()
+	s := sieve.NewWithOptions[int, int](3,
+		sieve.WithClock[int, int](clk),
+		sieve.WithOnEvict(func(k, v int) {
+			evicted = append(evicted, k)
+		}),
+		sieve.WithOnRemove(func(k, v int, c sieve.Cause) {
+			assert(v == k*10, "%d: exp value %d, saw %d", k, k*10, v)
+			got = append(got, removal{k, c})
+		}),
+	)
+
+	s.Add(1, 10)
+	s.Add(2, 20)
+	s.AddWithTTL(3, 30, time.Second)
+
+	// replacing isn't a removal
+	s.Add(2, 20)
+	assert(len(got) == 0, "exp no removals, saw %v", got)
+
+	// 1 is the oldest unvisited entry
+	s.Add(4, 40)
+	assert(len(got) == 1 && got[0] == removal{1, sieve.CauseEvicted}, "evict: saw %v", got)
+
+	s.Delete(4)
+	assert(len(got) == 2 && got[1] == removal{4, sieve.CauseDeleted}, "delete: saw %v", got)
+
+	clk.Advance(2 * time.Second)
+	_, ok := s.Get(3)
+	assert(!ok, "exp 3 to expire")
+	assert(len(got) == 3 && got[2] == removal{3, sieve.CauseExpired}, "expire: saw %v", got)
+
+	s.Add(5, 50)
+	s.Purge()
+	assert(len(got) == 5, "purge: exp 5 removals, saw %v", got)
+	for _, r := range got[3:] {
+		assert(r.cause == sieve.CausePurged, "purge: saw %v", got)
+	}
+
+	// the eviction callback only sees evictions
+	assert(len(evicted) == 1 && evicted[0] == 1, "exp 1 eviction, saw %v", evicted)
+	assert(sieve.CauseExpired.String() == "expired", "wrong cause name %s", sieve.CauseExpired)
+}
+
+func TestAddError(t *testing.T) {
+	assert := newAsserter(t)
+
+	errLoad := errors.New("load failed")
+	clk := newFakeClock()
+	s := sieve.NewWithOptions[string, int](4, sieve.WithClock[string, int](clk))
+
+	s.Add("a", 1)
+	s.AddError("b", errLoad, time.Second)
+
+	for i := 0; i < 3; i++ {
+		v, err, ok := s.GetErr("b")
+		assert(ok && err == errLoad && v == 0, "%d: exp cached error, saw %d %v %v", i, v, err, ok)
+		clk.Advance(100 * time.Millisecond)
+	}
+
+	v, err, ok := s.GetErr("a")
+	assert(ok && err == nil && v == 1, "exp value for a, saw %d %v %v", v, err, ok)
+
+	// value lookups don't see the error
+	_, ok = s.Get("b")
+	assert(!ok, "exp Get to miss on a cached error")
+	e, ok := s.GetEntry("b")
+	assert(ok && e.Err == errLoad, "exp error in entry, saw %+v", e)
+
+	// until it expires
+	clk.Advance(time.Second)
+	_, err, ok = s.GetErr("b")
+	assert(!ok && err == nil, "exp expired error, saw %v %v", err, ok)
+
+	// a value replaces the error
+	s.AddError("c", errLoad, 0)
+	s.Add("c", 3)
+	v, err, ok = s.GetErr("c")
+	assert(ok && err == nil && v == 3, "exp value to replace error, saw %d %v %v", v, err, ok)
+
+	// a probe inserts over a cached error
+	s.AddError("d", errLoad, 0)
+	v, ok = s.Probe("d", 4)
+	assert(!ok && v == 4, "exp probe to insert, saw %d %v", v, ok)
+	v, ok = s.Get("d")
+	assert(ok && v == 4, "exp 4, saw %d %v", v, ok)
+}
+
+func TestRemoveExpired(t *testing.T) {
+	assert := newAsserter(t)
+
+	var expired []int
+	clk := newFakeClock()
+	s := sieve.NewWithOptions[int, int](16,
+		sieve.WithClock[int, int](clk),
+		sieve.WithOnRemove(func(k, _ int, c sieve.Cause) {
+			assert(c == sieve.CauseExpired, "%d: exp expiry, saw %s", k, c)
+			expired = append(expired, k)
+		}))
+
+	for i := 0; i < 10; i++ {
+		s.AddWithTTL(i, i, time.Duration(i)*time.Second)
+	}
+
+	assert(s.RemoveExpired() == 0, "exp nothing to expire")
+
+	// 1..4 expire; 0 never expires
+	clk.Advance(4*time.Second + time.Millisecond)
+	n := s.RemoveExpired()
+	assert(n == 4, "exp 4 expired, saw %d", n)
+	assert(s.Len() == 6, "exp 6 entries, saw %d", s.Len())
+	slices.Sort(expired)
+	assert(fmt.Sprint(expired) == "[1 2 3 4]", "exp [1 2 3 4], saw %v", expired)
+
+	for i := 0; i < 10; i++ {
+		_, ok := s.Get(i)
+		assert(ok == (i == 0 || i > 4), "%d: wrong presence %v", i, ok)
+	}
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
+
+func TestOptionsOnReplace(t *testing.T) {
+	assert := newAsserter(t)
+
+	var got []string
+	var removed int
+	s := sieve.NewWithOptions[string, int](2,
+		sieve.WithOnReplace(func(k string, old, new int) {
+			got = append(got, fmt.Sprintf("%s:%d->%d", k, old, new))
+		}),
+		sieve.WithOnRemove(func(string, int, sieve.Cause) {
+			removed++
+		}))
+
+	s.Add("a", 1)
+	s.Add("b", 2)
+	assert(len(got) == 0, "exp no replacements on insert, saw %v", got)
+
+	s.Add("a", 10)
+	sieve.CompareAndSwap(s, "b", 2, 20)
+	sieve.CompareAndSwap(s, "b", 2, 200)
+	sieve.Increment(s, "a", 1)
+
+	exp := "[a:1->10 b:2->20 a:10->11]"
+	assert(fmt.Sprint(got) == exp, "exp %s, saw %v", exp, got)
+	assert(removed == 0, "exp no removals, saw %d", removed)
+
+	// evictions aren't replacements
+	s.Add("c", 3)
+	assert(len(got) == 3 && removed == 1, "exp an eviction, saw %v %d", got, removed)
+}
+
+func TestOptionsEvictTraceResize(t *testing.T) {
+	assert := newAsserter(t)
+
+	var trace []sieve.EvictTrace[int]
+	s := sieve.NewWithOptions[int, int](5,
+		sieve.WithEvictTrace[int, int](func(t sieve.EvictTrace[int]) {
+			trace = append(trace, t)
+		}))
+
+	for i := 0; i < 5; i++ {
+		s.Add(i, i)
+	}
+	s.Get(0)
+	s.Get(1)
+
+	// the visited entries are passed over and kept
+	s.ResizeKeepVisited(2)
+	exp := []sieve.EvictTrace[int]{
+		{Key: 0, Visited: true, Scan: 0},
+		{Key: 1, Visited: true, Scan: 1},
+		{Key: 2, Visited: false, Evicted: true, Scan: 2},
+		{Key: 3, Visited: false, Evicted: true, Scan: 0},
+		{Key: 4, Visited: false, Evicted: true, Scan: 0},
+	}
+	assert(fmt.Sprint(trace) == fmt.Sprint(exp), "exp %v, saw %v", exp, trace)
+
+	st := s.Stats()
+	assert(st.Evictions == 3, "exp 3 evictions, saw %d", st.Evictions)
+	assert(st.EvictScans == 2, "exp 2 scans, saw %d", st.EvictScans)
+	k, ok := s.LastEvicted()
+	assert(ok && k == 4, "exp 4 to be evicted last, saw %d %v", k, ok)
+
+	// only visited entries are left; they're evicted in hand order
+	trace = trace[:0]
+	s.ResizeKeepVisited(1)
+	assert(len(trace) > 0, "exp a trace")
+	last := trace[len(trace)-1]
+	assert(last.Key == 0 && last.Visited && last.Evicted, "exp 0 to be evicted, saw %v", trace)
+	k, _ = s.LastEvicted()
+	assert(k == 0 && s.Stats().Evictions == 4, "exp 0 to be evicted last, saw %d", k)
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
+
+func TestOptionsEvictTrace(t *testing.T) {
+	assert := newAsserter(t)
+
+	var trace []sieve.EvictTrace[int]
+	s := sieve.NewWithOptions[int, int](3,
+		sieve.WithEvictTrace[int, int](func(t sieve.EvictTrace[int]) {
+			trace = append(trace, t)
+		}))
+
+	s.Add(1, 1)
+	s.Add(2, 2)
+	s.Add(3, 3)
+	s.Get(1)
+	s.Get(2)
+	assert(len(trace) == 0, "exp no trace before eviction, saw %v", trace)
+
+	// the hand spares 1 and 2 and evicts 3
+	s.Add(4, 4)
+	exp := []sieve.EvictTrace[int]{
+		{Key: 1, Visited: true, Scan: 0},
+		{Key: 2, Visited: true, Scan: 1},
+		{Key: 3, Visited: false, Evicted: true, Scan: 2},
+	}
+	assert(fmt.Sprint(trace) == fmt.Sprint(exp), "exp %v, saw %v", exp, trace)
+
+	// 3 was the newest entry; so the hand wraps around to the tail
+	// where 1 is no longer visited
+	trace = trace[:0]
+	s.Add(5, 5)
+	exp = []sieve.EvictTrace[int]{
+		{Key: 1, Visited: false, Evicted: true, Scan: 0},
+	}
+	assert(fmt.Sprint(trace) == fmt.Sprint(exp), "exp %v, saw %v", exp, trace)
+}
+
+func TestOptionsAutoGrow(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.NewWithOptions[int, int](4, sieve.WithAutoGrow[int, int](12))
+
+	caps := []int{}
+	for i := 0; i < 20; i++ {
+		s.Add(i, i)
+		if n := len(caps); n == 0 || caps[n-1] != s.Cap() {
+			caps = append(caps, s.Cap())
+		}
+	}
+
+	// 4 -> 8 -> 12 (clamped) and then evictions
+	assert(fmt.Sprint(caps) == "[4 8 12]", "exp [4 8 12], saw %v", caps)
+	assert(s.Len() == 12, "exp 12 entries, saw %d", s.Len())
+	assert(s.Stats().Evictions == 8, "exp 8 evictions, saw %d", s.Stats().Evictions)
+
+	// the oldest 8 were evicted only after the cache stopped growing
+	for i := 0; i < 12; i++ {
+		_, ok := s.Inspect().Visited[i]
+		assert(ok == (i >= 8), "%d: wrong presence %v", i, ok)
+	}
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
+
+func TestOptionsFullPolicy(t *testing.T) {
+	assert := newAsserter(t)
+
+	var evicted int
+	s := sieve.NewWithOptions[int, int](4,
+		sieve.WithFullPolicy[int, int](sieve.FullReject),
+		sieve.WithOnEvict(func(k, v int) {
+			evicted++
+		}))
+
+	for i := 0; i < 4; i++ {
+		r := s.TryAdd(i, i)
+		assert(r == sieve.AddInserted, "%d: exp insert, saw %d", i, r)
+	}
+	before := s.EvictionOrder()
+
+	r := s.TryAdd(10, 10)
+	assert(r == sieve.AddRejected, "exp reject on a full cache, saw %d", r)
+	assert(!s.Add(11, 11), "exp Add to not replace")
+	v, ok := s.Probe(12, 12)
+	assert(!ok && v == 12, "exp probe miss, saw %d %v", v, ok)
+
+	assert(evicted == 0, "exp no evictions, saw %d", evicted)
+	assert(s.Len() == 4, "exp 4 entries, saw %d", s.Len())
+	for _, k := range []int{10, 11, 12} {
+		_, ok := s.Get(k)
+		assert(!ok, "%d: exp to be absent", k)
+	}
+	after := s.EvictionOrder()
+	assert(slices.Equal(before, after), "contents changed: %v vs %v", before, after)
+
+	// existing keys can still be replaced
+	r = s.TryAdd(2, 20)
+	assert(r == sieve.AddReplaced, "exp replace, saw %d", r)
+	v, _ = s.Get(2)
+	assert(v == 20, "exp 20, saw %d", v)
+
+	// and deleting makes room
+	s.Delete(0)
+	r = s.TryAdd(10, 10)
+	assert(r == sieve.AddInserted, "exp insert after delete, saw %d", r)
+
+	// the compute and bulk adds can't reject; they evict
+	_, added := s.GetOrAddFunc(13, func(k int) int { return k })
+	assert(added && evicted == 1, "exp GetOrAddFunc to evict, saw %v %d", added, evicted)
+	assert(s.Len() == 4, "exp 4 entries, saw %d", s.Len())
+
+	// the default evicts
+	d := sieve.New[int, int](1)
+	d.Add(1, 1)
+	r = d.TryAdd(2, 2)
+	assert(r == sieve.AddInserted && d.Len() == 1, "exp evict and insert, saw %d", r)
+}
+
+func TestOptionsObserver(t *testing.T) {
+	assert := newAsserter(t)
+
+	var got []string
+	rec := func(ev string) func(string, int) {
+		return func(k string, v int) {
+			got = append(got, fmt.Sprintf("%s:%s=%d", ev, k, v))
+		}
+	}
+	s := sieve.NewWithOptions[string, int](2,
+		sieve.WithObserver(sieve.Observer[string, int]{
+			OnInsert: rec("insert"),
+			OnHit: func(k string) {
+				got = append(got, "hit:"+k)
+			},
+			OnMiss: func(k string) {
+				got = append(got, "miss:"+k)
+			},
+			OnEvict:  rec("evict"),
+			OnDelete: rec("delete"),
+		}))
+
+	s.Add("a", 1)
+	s.Add("b", 2)
+	s.Get("a")
+	s.Get("x")
+	s.Add("c", 3)
+	s.Probe("c", 30)
+	s.Probe("d", 4)
+	s.Delete("c")
+	s.GetEach([]string{"a", "y"}, func(string, int) {})
+
+	exp := []string{
+		"insert:a=1", "insert:b=2", "hit:a", "miss:x",
+		"evict:b=2", "insert:c=3", "hit:c",
+		"miss:d", "evict:a=1", "insert:d=4",
+		"delete:c=3", "miss:a", "miss:y",
+	}
+	assert(slices.Equal(got, exp), "exp\n%v\nsaw\n%v", exp, got)
+
+	// a partial observer is fine
+	var hits int
+	p := sieve.NewWithOptions[string, int](2,
+		sieve.WithObserver(sieve.Observer[string, int]{
+			OnHit: func(string) { hits++ },
+		}))
+	p.Add("a", 1)
+	p.Get("a")
+	p.Get("b")
+	p.Delete("a")
+	assert(hits == 1, "exp 1 hit, saw %d", hits)
+}
+
+func TestOptionsCallbackReentry(t *testing.T) {
+	assert := newAsserter(t)
+
+	var s *sieve.Sieve[int, int]
+	s = sieve.NewWithOptions[int, int](2,
+		sieve.WithOnEvict(func(k, v int) {
+			// put odd keys back - evicting another entry
+			if k%2 == 1 && k < 100 {
+				s.Add(k+100, v)
+			}
+		}),
+		sieve.WithOnReplace(func(k, old, new int) {
+			s.Delete(k)
+		}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 8; i++ {
+			s.Add(i, i)
+		}
+		s.Add(7, 70)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("deadlock: callback re-entering the cache")
+	}
+
+	_, ok := s.Get(7)
+	assert(!ok, "exp OnReplace to delete 7")
+	assert(s.Len() <= 2, "exp at most 2 entries, saw %d", s.Len())
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
+
+func TestOptionsHandStart(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.NewWithOptions[int, int](4, sieve.WithHandStart[int, int](sieve.HandFromHead))
+	for i := 0; i < 4; i++ {
+		s.Add(i, i)
+	}
+
+	// the hand starts at the newest entry (3)
+	s.Get(3)
+	s.Add(4, 4)
+	k, _ := s.LastEvicted()
+	assert(k == 2, "exp 2 evicted, saw %d", k)
+	assert(s.IsHand(1), "exp hand at 1")
+
+	// the predicted victims match the actual ones in either direction
+	for _, h := range []sieve.HandStart{sieve.HandFromTail, sieve.HandFromHead} {
+		for _, mode := range []sieve.InsertMode{sieve.InsertAtHead, sieve.InsertAtTail} {
+			s := sieve.NewWithOptions[int, int](16,
+				sieve.WithHandStart[int, int](h),
+				sieve.WithInsertMode[int, int](mode))
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < 5000; i++ {
+				k := r.Intn(48)
+				if r.Intn(3) == 0 {
+					s.Delete(k)
+					continue
+				}
+				if _, ok := s.Get(k); ok {
+					continue
+				}
+
+				full := s.Len() == 16
+				want := s.ColdestN(1)
+				s.Add(k, k)
+				if full {
+					got, _ := s.LastEvicted()
+					assert(got == want[0], "%d/%d: exp %d evicted, saw %d", h, mode, want[0], got)
+				}
+			}
+			assert(s.Validate() == nil, "%d/%d: invariants: %v", h, mode, s.Validate())
+		}
+	}
+}
+
+func TestOptionsHandStartHitRatio(t *testing.T) {
+	// a skewed working set interrupted by one-time scans
+	r := rand.New(rand.NewSource(42))
+	trace := make([]int, 0, 200000)
+	for len(trace) < cap(trace) {
+		if r.Intn(2000) == 0 {
+			base := 1000000 + len(trace)
+			for i := 0; i < 500; i++ {
+				trace = append(trace, base+i)
+			}
+			continue
+		}
+		trace = append(trace, int(r.ExpFloat64()*300))
+	}
+
+	ratio := func(h sieve.HandStart) float64 {
+		s := sieve.NewWithOptions[int, int](1000, sieve.WithHandStart[int, int](h))
+		for _, k := range trace {
+			s.Probe(k, k)
+		}
+		st := s.Stats()
+		return float64(st.Hits) / float64(st.Hits+st.Misses)
+	}
+
+	tail := ratio(sieve.HandFromTail)
+	head := ratio(sieve.HandFromHead)
+	t.Logf("hit ratio: from tail %4.3f, from head %4.3f", tail, head)
+	if tail <= 0 || head <= 0 {
+		t.Fatalf("exp non-zero hit ratios; saw %4.3f %4.3f", tail, head)
+	}
+}
+
+// closer counts the calls to its Close
+type closer struct {
+	id     int
+	closed *map[int]int
+}
+
+func (c *closer) Close() error {
+	(*c.closed)[c.id]++
+	return nil
+}
+
+func TestOptionsAutoClose(t *testing.T) {
+	assert := newAsserter(t)
+
+	closed := make(map[int]int)
+	val := func(id int) *closer {
+		return &closer{id, &closed}
+	}
+
+	clk := newFakeClock()
+	s := sieve.NewWithOptions[int, *closer](3,
+		sieve.WithAutoClose[int, *closer](),
+		sieve.WithClock[int, *closer](clk))
+	for i := 0; i < 3; i++ {
+		s.Add(i, val(i))
+	}
+
+	// eviction
+	s.Add(3, val(3))
+	assert(fmt.Sprint(closed) == "map[0:1]", "exp 0 closed once, saw %v", closed)
+
+	// replacing the value doesn't close it
+	v1, _ := s.Get(1)
+	s.Add(1, v1)
+	assert(len(closed) == 1, "exp no close on replace, saw %v", closed)
+
+	// delete, expiry and purge
+	s.Delete(2)
+	s.AddWithTTL(4, val(4), time.Second)
+	clk.Advance(2 * time.Second)
+	s.Get(4)
+	s.Purge()
+	assert(fmt.Sprint(closed) == "map[0:1 1:1 2:1 3:1 4:1]", "exp each closed once, saw %v", closed)
+
+	// values that aren't closers are left alone
+	p := sieve.NewWithOptions[int, int](1, sieve.WithAutoClose[int, int]())
+	p.Add(1, 1)
+	p.Add(2, 2)
+	assert(p.Len() == 1, "exp 1 entry, saw %d", p.Len())
+}
+
+func TestOptionsTombstones(t *testing.T) {
+	assert := newAsserter(t)
+
+	var deleted []int
+	a := &countingAlloc{}
+	s := sieve.NewWithOptions[int, int](8,
+		sieve.WithTombstones[int, int](),
+		sieve.WithAllocator[int, int](a),
+		sieve.WithOnRemove[int, int](func(k, _ int, c sieve.Cause) {
+			if c == sieve.CauseDeleted {
+				deleted = append(deleted, k)
+			}
+		}))
+	for i := 0; i < 8; i++ {
+		s.Add(i, i)
+	}
+
+	// tombstoned keys are gone at once - but their nodes aren't freed
+	n := s.DeleteMulti([]int{0, 1, 2, 3, 99})
+	assert(n == 4, "exp 4 deletes, saw %d", n)
+	assert(s.Len() == 4, "exp len 4, saw %d", s.Len())
+	assert(a.frees == 0, "exp no frees, saw %d", a.frees)
+	assert(fmt.Sprint(deleted) == "[0 1 2 3]", "exp delete callbacks, saw %v", deleted)
+	for i := 0; i < 4; i++ {
+		_, ok := s.Get(i)
+		assert(!ok, "%d: exp tombstoned key to be absent", i)
+	}
+	for i := 4; i < 8; i++ {
+		v, ok := s.Get(i)
+		assert(ok && v == i, "%d: exp to find it, saw %d %v", i, v, ok)
+	}
+
+	// compaction reclaims them
+	s.Compact()
+	assert(a.frees == 4, "exp 4 frees, saw %d", a.frees)
+	assert(fmt.Sprint(s.Keys()) == "[7 6 5 4]", "wrong keys %v", s.Keys())
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+
+	v, ok := s.DeleteValue(4)
+	assert(ok && v == 4, "exp to delete 4, saw %d %v", v, ok)
+	assert(!s.Delete(4), "exp 4 to be gone")
+	_, ok = s.Get(4)
+	assert(!ok, "exp tombstoned 4 to be absent")
+
+	// the tombstone holds its slot until the cache fills up; then
+	// it is reclaimed instead of evicting a live entry
+	for i := 10; i < 14; i++ {
+		s.Add(i, i)
+	}
+	assert(a.frees == 4, "exp no frees yet, saw %d", a.frees)
+	s.Add(14, 14)
+	assert(a.frees == 5, "exp 5 frees, saw %d", a.frees)
+	assert(s.Len() == 8, "exp len 8, saw %d", s.Len())
+	assert(s.Stats().Evictions == 0, "exp no evictions, saw %d", s.Stats().Evictions)
+
+	// the next eviction reclaims tombstones too
+	s.Delete(14)
+	s.Add(15, 15)
+	s.Add(16, 16)
+	assert(a.frees == 7, "exp 7 frees, saw %d", a.frees)
+	assert(s.Stats().Evictions == 1, "exp 1 eviction, saw %d", s.Stats().Evictions)
+	assert(a.news-a.frees == s.Len(), "leaked nodes: %d allocs %d frees", a.news, a.frees)
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
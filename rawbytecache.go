@@ -0,0 +1,233 @@
+// rawbytecache.go - SIEVE cache specialized to byte slice keys and values
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve
+
+import (
+	"bytes"
+	"hash/maphash"
+	"sync"
+)
+
+// RawByteCache is a SIEVE cache specialized to byte slice keys and
+// values - without generics. Keys are hashed and copied into the
+// cache; so callers can freely modify a key after adding it. Values
+// are stored as given and returned without copying: callers must not
+// modify a value after adding it or after getting it from the cache.
+// Unlike Sieve, lookups take the cache lock. See BytesSieve for a
+// cache of byte slice keys and values of any type.
+type RawByteCache struct {
+	mu       sync.Mutex
+	cache    map[uint64]*bnode
+	head     *bnode
+	tail     *bnode
+	hand     *bnode
+	size     int
+	capacity int
+
+	seed maphash.Seed
+	hash func(key []byte) uint64
+}
+
+// bnode is an entry of a RawByteCache; entries whose keys have the same
+// hash are chained via 'chain'.
+type bnode struct {
+	key     []byte
+	val     []byte
+	hash    uint64
+	visited bool
+	next    *bnode
+	prev    *bnode
+	chain   *bnode
+}
+
+// NewRawByteCache creates a new cache of size 'capacity' mapping byte
+// slice keys to byte slice values.
+func NewRawByteCache(capacity int) *RawByteCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	b := &RawByteCache{
+		cache:    make(map[uint64]*bnode, capacity),
+		capacity: capacity,
+		seed:     maphash.MakeSeed(),
+	}
+	b.hash = func(key []byte) uint64 {
+		return maphash.Bytes(b.seed, key)
+	}
+	return b
+}
+
+// Get fetches the value for 'key' and marks it as accessed
+func (b *RawByteCache) Get(key []byte) ([]byte, bool) {
+	h := b.hash(key)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n := b.find(h, key); n != nil {
+		n.visited = true
+		return n.val, true
+	}
+	return nil, false
+}
+
+// Add adds or replaces the value for a copy of 'key'. It returns true
+// if an existing value was replaced.
+func (b *RawByteCache) Add(key, val []byte) bool {
+	h := b.hash(key)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n := b.find(h, key); n != nil {
+		n.val = val
+		n.visited = true
+		return true
+	}
+
+	// reuse the victim's node and key buffer for the new entry
+	var n *bnode
+	if b.size >= b.capacity {
+		n = b.evict()
+	}
+	if n == nil {
+		n = &bnode{}
+	}
+
+	*n = bnode{
+		key:   append(n.key[:0], key...),
+		val:   val,
+		hash:  h,
+		chain: b.cache[h],
+	}
+	b.cache[h] = n
+	b.insertHead(n)
+	return false
+}
+
+// Delete deletes 'key' from the cache and returns true if it was
+// present.
+func (b *RawByteCache) Delete(key []byte) bool {
+	h := b.hash(key)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := b.find(h, key)
+	if n == nil {
+		return false
+	}
+	b.remove(n)
+	return true
+}
+
+// Len returns the number of entries in the cache
+func (b *RawByteCache) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// Cap returns the capacity of the cache
+func (b *RawByteCache) Cap() int {
+	return b.capacity
+}
+
+// Purge removes all the entries from the cache
+func (b *RawByteCache) Purge() {
+	b.mu.Lock()
+	b.cache = make(map[uint64]*bnode, b.capacity)
+	b.head, b.tail, b.hand = nil, nil, nil
+	b.size = 0
+	b.mu.Unlock()
+}
+
+// find returns the node for 'key' whose hash is 'h'
+// NB: Caller must hold the lock
+func (b *RawByteCache) find(h uint64, key []byte) *bnode {
+	for n := b.cache[h]; n != nil; n = n.chain {
+		if bytes.Equal(n.key, key) {
+			return n
+		}
+	}
+	return nil
+}
+
+// evict removes the next SIEVE victim and returns its node
+// NB: Caller must hold the lock
+func (b *RawByteCache) evict() *bnode {
+	hand := b.hand
+	if hand == nil {
+		hand = b.tail
+	}
+
+	for hand != nil {
+		if !hand.visited {
+			b.remove(hand)
+			return hand
+		}
+		hand.visited = false
+		if hand = hand.prev; hand == nil {
+			hand = b.tail
+		}
+	}
+	return nil
+}
+
+// insertHead adds a node at the head of the list
+// NB: Caller must hold the lock
+func (b *RawByteCache) insertHead(n *bnode) {
+	n.next = b.head
+	if b.head != nil {
+		b.head.prev = n
+	}
+	b.head = n
+	if b.tail == nil {
+		b.tail = n
+	}
+	b.size++
+}
+
+// remove unlinks a node from its hash chain and the list
+// NB: Caller must hold the lock
+func (b *RawByteCache) remove(n *bnode) {
+	if c := b.cache[n.hash]; c == n {
+		if n.chain != nil {
+			b.cache[n.hash] = n.chain
+		} else {
+			delete(b.cache, n.hash)
+		}
+	} else {
+		for ; c.chain != n; c = c.chain {
+		}
+		c.chain = n.chain
+	}
+
+	if b.hand == n {
+		b.hand = n.prev
+	}
+	if n.prev != nil {
+		n.prev.next = n.next
+	} else {
+		b.head = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
+	} else {
+		b.tail = n.prev
+	}
+
+	n.val = nil
+	n.next, n.prev, n.chain = nil, nil, nil
+	b.size--
+}
@@ -0,0 +1,97 @@
+// rawbytecache_test.go -- tests for the byte slice cache
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/opencoff/go-sieve"
+)
+
+func TestRawByteCache(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.NewRawByteCache(4)
+	key := []byte("hello")
+	assert(!s.Add(key, []byte("world")), "exp insert of new key")
+
+	// the cache has its own copy of the key
+	copy(key, "jello")
+	_, ok := s.Get(key)
+	assert(!ok, "exp miss on the mutated key")
+	v, ok := s.Get([]byte("hello"))
+	assert(ok && string(v) == "world", "exp world, saw %q %v", v, ok)
+	assert(s.Add([]byte("hello"), []byte("there")), "exp replace")
+
+	// SIEVE eviction: hello is visited, so 'a' goes first
+	for _, k := range []string{"a", "b", "c", "d"} {
+		s.Add([]byte(k), []byte(k))
+	}
+	assert(s.Len() == 4, "exp 4 entries, saw %d", s.Len())
+	_, ok = s.Get([]byte("a"))
+	assert(!ok, "exp a to be evicted")
+	v, ok = s.Get([]byte("hello"))
+	assert(ok && string(v) == "there", "exp there, saw %q %v", v, ok)
+
+	assert(s.Delete([]byte("c")), "exp delete of c")
+	assert(!s.Delete([]byte("c")), "exp c to be gone")
+	assert(s.Len() == 3, "exp 3 entries, saw %d", s.Len())
+
+	s.Purge()
+	assert(s.Len() == 0 && s.Cap() == 4, "exp an empty cache of cap 4")
+	_, ok = s.Get([]byte("hello"))
+	assert(!ok, "exp empty cache")
+}
+
+func TestRawByteCacheCollisions(t *testing.T) {
+	assert := newAsserter(t)
+
+	// every key hashes the same
+	s := sieve.NewRawByteCache(8)
+	sieve.SetByteHash(s, func([]byte) uint64 { return 42 })
+
+	key := func(i int) []byte {
+		return []byte(fmt.Sprintf("key-%d", i))
+	}
+	for i := 0; i < 8; i++ {
+		s.Add(key(i), key(i+100))
+	}
+	for i := 0; i < 8; i++ {
+		v, ok := s.Get(key(i))
+		assert(ok && string(v) == string(key(i+100)), "%d: exp %s, saw %q %v", i, key(i+100), v, ok)
+	}
+
+	// delete from the middle, the head and the tail of the chain
+	for _, i := range []int{3, 7, 0} {
+		assert(s.Delete(key(i)), "%d: exp delete", i)
+		_, ok := s.Get(key(i))
+		assert(!ok, "%d: exp to be gone", i)
+	}
+	for _, i := range []int{1, 2, 4, 5, 6} {
+		_, ok := s.Get(key(i))
+		assert(ok, "%d: exp to be present", i)
+	}
+
+	// evictions unlink colliding keys correctly
+	for i := 10; i < 40; i++ {
+		s.Add(key(i), key(i))
+	}
+	assert(s.Len() == 8, "exp 8 entries, saw %d", s.Len())
+	for i := 32; i < 40; i++ {
+		v, ok := s.Get(key(i))
+		assert(ok && string(v) == string(key(i)), "%d: exp to be present, saw %q %v", i, v, ok)
+	}
+}
@@ -0,0 +1,118 @@
+// rindex.go - optional reverse index from values to keys
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve
+
+import (
+	"sync"
+)
+
+// WithReverseIndex maintains an index from values to the keys that map
+// to them (see KeysForValue). The index costs memory proportional to
+// the number of entries and adds a map update to every insert, update
+// and removal.
+func WithReverseIndex[K comparable, V comparable]() Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.rindex = newRindex[K]()
+	}
+}
+
+// KeysForValue returns the keys whose value is equal to 'val'; the
+// keys are in no particular order. It returns nil if the cache wasn't
+// created with WithReverseIndex. KeysForValue doesn't mark the entries
+// as visited.
+func (s *Sieve[K, V]) KeysForValue(val V) []K {
+	if s.rindex == nil {
+		return nil
+	}
+
+	keys := s.rindex.get(val)
+	out := keys[:0]
+	for _, k := range keys {
+		if n, ok := s.cache.Get(k); ok && !s.expired(n) {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// rindex maps values to the set of keys holding them. The values are
+// stored as 'any' - and are guaranteed to be comparable by
+// WithReverseIndex.
+type rindex[K comparable] struct {
+	sync.Mutex
+	m map[any][]K
+}
+
+func newRindex[K comparable]() *rindex[K] {
+	return &rindex[K]{
+		m: make(map[any][]K),
+	}
+}
+
+// add records that 'key' maps to 'val'
+func (r *rindex[K]) add(key K, val any) {
+	r.Lock()
+	r.m[val] = append(r.m[val], key)
+	r.Unlock()
+}
+
+// del forgets that 'key' maps to 'val'
+func (r *rindex[K]) del(key K, val any) {
+	r.Lock()
+	r.drop(key, val)
+	r.Unlock()
+}
+
+// update moves 'key' from value 'old' to 'val'
+func (r *rindex[K]) update(key K, old, val any) {
+	r.Lock()
+	r.drop(key, old)
+	r.m[val] = append(r.m[val], key)
+	r.Unlock()
+}
+
+// get returns a copy of the keys mapping to 'val'
+func (r *rindex[K]) get(val any) []K {
+	r.Lock()
+	keys := append([]K(nil), r.m[val]...)
+	r.Unlock()
+	return keys
+}
+
+// reset forgets all the mappings
+func (r *rindex[K]) reset() {
+	r.Lock()
+	r.m = make(map[any][]K)
+	r.Unlock()
+}
+
+// drop removes 'key' from the keys of 'val'
+// NB: Caller must hold the lock
+func (r *rindex[K]) drop(key K, val any) {
+	keys := r.m[val]
+	for i := range keys {
+		if keys[i] == key {
+			keys[i] = keys[len(keys)-1]
+			keys = keys[:len(keys)-1]
+			break
+		}
+	}
+
+	if len(keys) == 0 {
+		delete(r.m, val)
+	} else {
+		r.m[val] = keys
+	}
+}
@@ -0,0 +1,74 @@
+// rindex_test.go -- tests for the reverse index
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/opencoff/go-sieve"
+)
+
+func TestReverseIndex(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.NewWithOptions[int, string](4, sieve.WithReverseIndex[int, string]())
+	keys := func(v string) string {
+		k := s.KeysForValue(v)
+		slices.Sort(k)
+		return fmt.Sprint(k)
+	}
+
+	s.Add(1, "a")
+	s.Add(2, "b")
+	s.Add(3, "a")
+	s.Add(4, "a")
+	assert(keys("a") == "[1 3 4]", "a: saw %s", keys("a"))
+	assert(keys("b") == "[2]", "b: saw %s", keys("b"))
+	assert(keys("c") == "[]", "c: saw %s", keys("c"))
+
+	// delete
+	s.Delete(3)
+	assert(keys("a") == "[1 4]", "a after delete: saw %s", keys("a"))
+
+	// replace
+	s.Add(4, "b")
+	assert(keys("a") == "[1]", "a after replace: saw %s", keys("a"))
+	assert(keys("b") == "[2 4]", "b after replace: saw %s", keys("b"))
+
+	// rekey
+	s.Rekey(4, 40)
+	assert(keys("b") == "[2 40]", "b after rekey: saw %s", keys("b"))
+
+	// evict: 1 is the oldest unvisited entry
+	s.Add(5, "c")
+	s.Add(6, "c")
+	assert(keys("a") == "[]", "a after evict: saw %s", keys("a"))
+	assert(keys("c") == "[5 6]", "c after evict: saw %s", keys("c"))
+	assert(s.Len() == 4, "exp 4 entries, saw %d", s.Len())
+
+	s.Purge()
+	assert(keys("b") == "[]", "b after purge: saw %s", keys("b"))
+	assert(keys("c") == "[]", "c after purge: saw %s", keys("c"))
+}
+
+func TestReverseIndexDisabled(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, string](4)
+	s.Add(1, "a")
+	assert(s.KeysForValue("a") == nil, "exp nil without an index")
+}
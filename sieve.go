@@ -31,19 +31,87 @@ package sieve
 
 import (
 	"fmt"
+	"io"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
-// node contains the <key, val> tuple as a node in a linked list.
-type node[K comparable, V any] struct {
-	sync.Mutex
+// Node contains the <key, val> tuple as a node in a linked list.
+// Its fields are private to the cache; it is exported only so that an
+// Allocator can hand out nodes.
+type Node[K comparable, V any] struct {
+	// mu guards the value, key, live and the cached error
+	mu      sync.Mutex
 	key     K
 	val     V
 	visited atomic.Bool
-	next    *node[K, V]
-	prev    *node[K, V]
+	next    *Node[K, V]
+	prev    *Node[K, V]
+
+	// x holds the metadata of the optional features; it is nil until
+	// a feature needs it - so a plain cache doesn't pay for them.
+	x atomic.Pointer[nodeExt]
+
+	// live is false once the node is removed from the cache; lock
+	// free readers may still hold it. It is guarded by the node lock.
+	live bool
+}
+
+// nodeExt is the per node metadata of the optional features. Once
+// attached, it stays with the node when the node is reused.
+type nodeExt struct {
+	// hits and added are tracked with WithHitCount
+	hits  atomic.Uint64
+	added time.Time
+
+	// expires and ttl are set for entries with a TTL
+	expires atomic.Int64
+	ttl     atomic.Int64
+
+	// size is the weight of the entry with a sizer or weigher
+	size int64
+
+	// freq is the access counter for PolicyFrequency
+	freq atomic.Uint32
+
+	// err is the cached load error set by AddError; it is guarded
+	// by the node lock.
+	err error
+}
+
+// ext returns the metadata of a node - attaching it if needed
+func (n *Node[K, V]) ext() *nodeExt {
+	if x := n.x.Load(); x != nil {
+		return x
+	}
+
+	// lock free writers (Add, Touch) may race with locked ones
+	x := new(nodeExt)
+	if !n.x.CompareAndSwap(nil, x) {
+		x = n.x.Load()
+	}
+	return x
+}
+
+// loadErr returns the cached load error of a node
+// NB: Caller must hold the node lock
+func (n *Node[K, V]) loadErr() error {
+	if x := n.x.Load(); x != nil {
+		return x.err
+	}
+	return nil
+}
+
+// clearErr drops the cached load error of a node
+// NB: Caller must hold the node lock
+func (n *Node[K, V]) clearErr() {
+	if x := n.x.Load(); x != nil {
+		x.err = nil
+	}
 }
 
 // Sieve represents a cache mapping the key of type 'K' with
@@ -52,198 +120,2554 @@ type node[K comparable, V any] struct {
 // new additions to the cache beyond the capacity will cause cache
 // eviction of other entries - as determined by the SIEVE algorithm.
 type Sieve[K comparable, V any] struct {
-	mu       sync.Mutex
-	cache    *syncMap[K, *node[K, V]]
-	head     *node[K, V]
-	tail     *node[K, V]
-	hand     *node[K, V]
+	mu       mutex
+	cache    kvmap[K, *Node[K, V]]
+	head     *Node[K, V]
+	tail     *Node[K, V]
+	hand     *Node[K, V]
 	size     int
 	capacity int
 
-	pool *syncPool[node[K, V]]
+	// countHits enables per-node hit counters (see TopN)
+	countHits bool
+
+	// insertAtTail adds new entries at the eviction hand
+	insertAtTail bool
+
+	// policy selects the eviction algorithm
+	policy Policy
+
+	// freqHits counts the hits since the frequency counters were
+	// last aged; only used by PolicyFrequency.
+	freqHits atomic.Uint64
+
+	// tombstones makes deletes leave the node in the list; the nodes
+	// in 'tombs' are unlinked by reap.
+	tombstones bool
+	tombs      []*Node[K, V]
+
+	// probeNoBoost stops Probe from marking entries as visited
+	probeNoBoost bool
+
+	// adapt is non-nil for caches created with NewAdaptive
+	adapt *adaptive
+
+	// sizer returns the approximate size in bytes of an entry
+	sizer func(K, V) int64
+
+	// maxWeight bounds the total size of all entries (as returned
+	// by sizer); zero means unbounded.
+	maxWeight int64
+
+	// rec records the latency of cache operations
+	rec Recorder
+
+	// clone copies values returned to callers
+	clone func(V) V
+
+	// the hand starts at the head and moves toward the tail
+	handHead bool
+
+	// reject new keys instead of evicting when the cache is full
+	reject bool
+
+	// close values that implement io.Closer when they leave the cache
+	autoClose bool
+
+	// obs observes the lifecycle of the entries
+	obs *Observer[K, V]
+
+	// the key of the most recent eviction, if any
+	lastEvicted K
+	evicted     bool
+
+	// number of entries to evict when the cache is full
+	batch int
+
+	// growMax is the capacity up to which a full cache doubles in
+	// size rather than evict
+	growMax int
+
+	// default TTL for new entries; zero means entries don't expire
+	ttl time.Duration
+
+	// sliding extends the TTL of entries on every hit
+	sliding bool
+
+	// onEvict is called for every evicted entry, onRemove for every
+	// removed entry and onReplace for every replaced value; these
+	// events are queued in pending until the lock is released.
+	onEvict   func(K, V)
+	onRemove  func(K, V, Cause)
+	onReplace func(K, V, V)
+	pending   []event[K, V]
+
+	// trace is called for every entry the hand examines
+	trace func(EvictTrace[K])
+
+	// evicted entries are captured in victims when capture is set
+	capture bool
+	victims []Entry[K, V]
+
+	stats stats
+
+	// rates holds the counters at the last call to RateStats
+	rates rates
+
+	// clock is the time source for TTLs, entry ages and rates
+	clock Clock
+
+	// window tracks the recent hit ratio
+	window *hitWindow
+
+	// thrash detects a working set larger than the cache
+	thrash thrash
+
+	// stripes is the number of map stripes and hash selects the
+	// stripe of a key; see WithStripes
+	stripes int
+	hash    func(K) uint64
+
+	// rindex maps values to keys when enabled by WithReverseIndex
+	rindex *rindex[K]
+
+	// gen is incremented on every change to the cache contents
+	gen atomic.Uint64
+
+	alloc Allocator[K, V]
+}
+
+// Cache is the common interface implemented by key-value caches;
+// Sieve implements it.
+type Cache[K comparable, V any] interface {
+	// Get fetches the value for a key and returns true if present
+	Get(key K) (V, bool)
+
+	// Add adds or replaces the value for a key and returns true
+	// if it replaced an existing value
+	Add(key K, val V) bool
+
+	// Remove deletes a key and returns true if it was present
+	Remove(key K) bool
+
+	// Len returns the number of entries in the cache
+	Len() int
+
+	// Purge removes all entries from the cache
+	Purge()
+}
+
+var _ Cache[int, int] = (*Sieve[int, int])(nil)
+
+// KeyCount is a key and the number of cache hits it has seen.
+type KeyCount[K comparable] struct {
+	Key  K
+	Hits uint64
+}
+
+// Entry is a snapshot of a single cache entry.
+type Entry[K comparable, V any] struct {
+	Key     K
+	Value   V
+	Visited bool
+
+	// Hits and Age are only tracked by caches created with
+	// NewWithHitCount; they're zero otherwise.
+	Hits uint64
+	Age  time.Duration
+
+	// Err is the error cached by AddError; Value is the zero value
+	// when Err is set.
+	Err error
+}
+
+// New creates a new cache of size 'capacity' mapping key 'K' to value 'V'.
+// 'capacity' is the maximum number of live entries (see Cap); no memory
+// is reserved up front. The cache holds at least one entry; a
+// 'capacity' less than 1 is treated as 1.
+func New[K comparable, V any](capacity int) *Sieve[K, V] {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	s := &Sieve[K, V]{
+		cache:    newSyncMap[K, *Node[K, V]](),
+		capacity: capacity,
+		alloc:    newSyncPool[Node[K, V]](),
+		clock:    sysClock{},
+	}
+	s.rates.at = s.clock.Now()
+	s.thrash.window = 1024
+	s.thrash.maxHit = 0.2
+	s.thrash.minEvict = 0.5
+	return s
+}
+
+// NewWithHitCount creates a new cache like New - but additionally
+// tracks the number of hits seen by each key. This is useful for
+// finding hot keys via TopN; it costs an extra counter per entry and
+// an atomic increment on every hit.
+func NewWithHitCount[K comparable, V any](capacity int) *Sieve[K, V] {
+	return NewWithOptions[K, V](capacity, WithHitCount[K, V]())
+}
+
+// NewWithSizer creates a new cache like New - but additionally keeps
+// track of the approximate number of bytes cached (Stats.BytesCached).
+// 'sizer' returns the size in bytes of a given entry.
+func NewWithSizer[K comparable, V any](capacity int, sizer func(K, V) int64) *Sieve[K, V] {
+	return NewWithOptions[K, V](capacity, WithSizer[K, V](sizer))
+}
+
+// InsertMode determines where new entries are inserted in the cache
+type InsertMode int
+
+const (
+	// InsertAtHead adds new entries at the head of the queue; this is
+	// the SIEVE default and gives new entries the most protection
+	// from eviction.
+	InsertAtHead InsertMode = iota
+
+	// InsertAtTail adds new entries where the eviction hand will
+	// look next (when the hand is not set, the tail of the queue - or
+	// the head with HandFromHead).
+	// Entries that aren't accessed again are evicted quickly - making
+	// the cache resistant to one-time sequential scans.
+	InsertAtTail
+)
+
+// Policy is the eviction algorithm used by the cache
+type Policy int
+
+const (
+	// PolicySieve is the SIEVE algorithm and the default: the hand
+	// sweeps from the tail toward the head and evicts the first entry
+	// that wasn't visited since the last sweep.
+	PolicySieve Policy = iota
+
+	// PolicyFIFO ignores accesses and always evicts the oldest entry
+	// (the tail).
+	PolicyFIFO
+
+	// PolicyLRU moves an entry to the head on every hit and always
+	// evicts the tail. Unlike SIEVE, every hit takes the cache lock.
+	PolicyLRU
+
+	// PolicyFrequency adds a small saturating access counter to each
+	// entry; it is incremented on every hit and all the counters are
+	// halved after every 10*capacity hits - so past popularity fades.
+	// The hand sweeps like SIEVE, but instead of evicting the first
+	// unvisited entry it looks at the next few unvisited entries and
+	// evicts the one with the lowest count. This favors entries that
+	// are accessed often over ones that were accessed once recently.
+	PolicyFrequency
+)
+
+const (
+	// freqMax is the saturation value of the access counters
+	freqMax = 15
+
+	// freqSample is the number of unvisited entries compared by
+	// PolicyFrequency to pick a victim
+	freqSample = 8
+
+	// freqAge is the number of hits - as a multiple of the capacity -
+	// after which the access counters are halved
+	freqAge = 10
+)
+
+// FromMap creates a new cache of size 'capacity' - configured by the
+// given options - and seeds it with the entries of 'm'. The entries
+// are added in map iteration order; once the cache is full the
+// remaining entries are dropped rather than evicting the ones already
+// added. This eases migrating from a plain map.
+func FromMap[K comparable, V any](capacity int, m map[K]V, opts ...Option[K, V]) *Sieve[K, V] {
+	s := NewWithOptions[K, V](capacity, opts...)
+
+	s.mu.Lock()
+	for k, v := range m {
+		if s.size >= s.capacity {
+			break
+		}
+		s.add(k, v)
+	}
+	s.unlock()
+	return s
+}
+
+// HandStart determines where the eviction hand starts - and thus the
+// direction in which it moves
+type HandStart int
+
+const (
+	// HandFromTail starts the hand at the tail (the oldest entry)
+	// and moves it toward the head; this is the SIEVE default.
+	HandFromTail HandStart = iota
+
+	// HandFromHead starts the hand at the head (the newest entry) and
+	// moves it toward the tail. New entries that aren't accessed again
+	// are examined - and evicted - first.
+	HandFromHead
+)
+
+// FullPolicy determines what happens when a new key is added to a
+// full cache
+type FullPolicy int
+
+const (
+	// FullEvict evicts an entry to make room; this is the default.
+	FullEvict FullPolicy = iota
+
+	// FullReject leaves the cache unchanged and rejects the new
+	// entry - giving bounded buffer semantics. It applies to Add,
+	// AddWithTTL, AddWeighted, TryAdd and Probe; replacing the value
+	// of an existing key always succeeds. The other ways of adding
+	// keys (GetOrAddFunc, Compute, Increment, AddVisited, AddError,
+	// Preload, AddMany, Merge and LoadStream) have no way to report a
+	// rejection: they always evict to make room.
+	FullReject
+)
+
+// AddResult is the outcome of TryAdd
+type AddResult int
+
+const (
+	// AddInserted means a new entry was added
+	AddInserted AddResult = iota
+
+	// AddReplaced means the value of an existing entry was replaced
+	AddReplaced
+
+	// AddRejected means the cache was full and configured with
+	// FullReject; it is unchanged.
+	AddRejected
+)
+
+// NewWithInsertMode creates a new cache like New - but inserts new
+// entries as determined by 'mode'.
+func NewWithInsertMode[K comparable, V any](capacity int, mode InsertMode) *Sieve[K, V] {
+	return NewWithOptions[K, V](capacity, WithInsertMode[K, V](mode))
+}
+
+// Get fetches the value for a given key in the cache.
+// It returns true if the key is in the cache, false otherwise.
+// The zero value for 'V' is returned when key is not in the cache.
+func (s *Sieve[K, V]) Get(key K) (V, bool) {
+	if s.rec != nil {
+		defer s.observe("get", time.Now())
+	}
+
+	if v, ok := s.lookup(key); ok {
+		if val, ok := s.load(v, key); ok {
+			s.touch(v, key)
+			s.tune()
+			return val, true
+		}
+	}
+
+	s.missed(key)
+	s.tune()
+	var x V
+	return x, false
+}
+
+// GetValid is Get with the expiry check made explicit at the call
+// site: an expired entry counts as a miss and is removed. Get already
+// does this; GetValid exists for callers that want the TTL semantics
+// visible where the cache is used.
+func (s *Sieve[K, V]) GetValid(key K) (V, bool) {
+	return s.Get(key)
+}
+
+// GetVisited is like Get - but also returns whether the entry was
+// already visited before this lookup; i.e., whether it has been hit
+// since it was added or since the hand last passed over it.
+func (s *Sieve[K, V]) GetVisited(key K) (val V, wasVisited bool, found bool) {
+	if v, ok := s.lookup(key); ok {
+		if val, ok := s.load(v, key); ok {
+			wasVisited = v.visited.Load()
+			s.touch(v, key)
+			s.tune()
+			return val, wasVisited, true
+		}
+	}
+
+	s.missed(key)
+	s.tune()
+	return val, false, false
+}
+
+// GetAndCool is like Get - but clears the visited flag of the entry
+// instead of setting it; so the entry is a candidate for the next
+// eviction unless it is accessed again. This suits entries that are
+// processed once and are cold after that. The lookup counts as a hit.
+func (s *Sieve[K, V]) GetAndCool(key K) (V, bool) {
+	if v, ok := s.lookup(key); ok {
+		if val, ok := s.load(v, key); ok {
+			v.visited.Store(false)
+			s.peek()
+			s.notify(evHit, key)
+			s.tune()
+			return val, true
+		}
+	}
+
+	s.missed(key)
+	s.tune()
+	var x V
+	return x, false
+}
+
+// GetEntry fetches a copy of the cache entry for 'key' - and like Get,
+// marks it as accessed. The returned snapshot reflects the state of
+// the entry prior to this lookup.
+func (s *Sieve[K, V]) GetEntry(key K) (*Entry[K, V], bool) {
+	if v, ok := s.lookup(key); ok {
+		if e, ok := s.entry(v); ok && e.Key == key {
+			s.touch(v, key)
+			s.tune()
+			return &e, true
+		}
+	}
+
+	s.missed(key)
+	s.tune()
+	return nil, false
+}
+
+// GetRef fetches a pointer to the value stored for 'key' - and like Get,
+// marks it as accessed. This avoids copying large values; but the
+// pointer refers to the cache's own storage:
+//
+//   - writes through the pointer mutate the cached value without any
+//     locking and bypass the sizer, the value cloner and the reverse
+//     index.
+//   - a concurrent Add, Delete or eviction of 'key' invalidates the
+//     pointer: it may then observe a zero value or the value of an
+//     unrelated key (nodes are recycled).
+//
+// Callers must copy what they need before any concurrent mutator can
+// touch 'key'.
+func (s *Sieve[K, V]) GetRef(key K) (*V, bool) {
+	if v, ok := s.lookup(key); ok && !s.failed(v) {
+		s.touch(v, key)
+		s.tune()
+		return &v.val, true
+	}
+
+	s.missed(key)
+	s.tune()
+	return nil, false
+}
+
+// GetBatch fetches the values for all the keys in 'keys' in a single
+// pass under the cache lock. It returns the values for the keys
+// present in the cache and the list of keys that aren't.
+func (s *Sieve[K, V]) GetBatch(keys []K) (map[K]V, []K) {
+	var misses []K
+
+	hits := make(map[K]V, len(keys))
+
+	s.mu.Lock()
+	for _, k := range keys {
+		if v, ok := s.getLocked(k); ok {
+			hits[k] = s.value(v)
+		} else {
+			misses = append(misses, k)
+		}
+	}
+	s.unlock()
+	s.tune()
+	return hits, misses
+}
+
+// GetEach fetches the values for all the keys in 'keys' in a single
+// pass under the cache lock and calls 'fn' for each key present in the
+// cache. Unlike GetBatch, it doesn't allocate. 'fn' is called with the
+// cache lock held; it must not call back into the cache.
+func (s *Sieve[K, V]) GetEach(keys []K, fn func(key K, val V)) {
+	s.mu.Lock()
+	for _, k := range keys {
+		if v, ok := s.getLocked(k); ok {
+			fn(k, s.value(v))
+		}
+	}
+	s.unlock()
+	s.tune()
+}
+
+// Add adds a new element to the cache or overwrite one if it exists
+// Return true if we replaced, false otherwise. With FullReject, a new
+// key isn't added to a full cache; use TryAdd to tell this apart.
+func (s *Sieve[K, V]) Add(key K, val V) bool {
+	if s.rec != nil {
+		defer s.observe("add", time.Now())
+	}
+	return s.addTTL(key, val, s.ttl) == AddReplaced
+}
+
+// TryAdd is like Add - but returns whether the entry was inserted,
+// replaced or - with FullReject - rejected because the cache is full.
+func (s *Sieve[K, V]) TryAdd(key K, val V) AddResult {
+	return s.addTTL(key, val, s.ttl)
+}
+
+// AddWithTTL is like Add - but the entry expires after 'ttl'
+// regardless of the cache's default TTL. A zero 'ttl' means the
+// entry never expires. Expired entries are removed lazily - when
+// they're next accessed or evicted.
+func (s *Sieve[K, V]) AddWithTTL(key K, val V, ttl time.Duration) bool {
+	return s.addTTL(key, val, ttl) == AddReplaced
+}
+
+// AddWeighted is like Add - but it rejects an entry that can never fit
+// the weight budget of a cache created with WithWeigher: if the entry
+// alone weighs more than the budget, the cache is left unchanged and
+// AddWeighted returns false. It also returns false if a full cache
+// with FullReject rejects the key; it returns true if the entry was
+// stored.
+func (s *Sieve[K, V]) AddWeighted(key K, val V) bool {
+	if s.maxWeight > 0 && s.sizer(key, val) > s.maxWeight {
+		return false
+	}
+	return s.addTTL(key, val, s.ttl) != AddRejected
+}
+
+// Touch changes the TTL of the entry for 'key' to 'ttl' from now -
+// without changing its value. A zero 'ttl' means the entry never
+// expires. It returns false if the key is not in the cache.
+func (s *Sieve[K, V]) Touch(key K, ttl time.Duration) bool {
+	n, ok := s.lookup(key)
+	if !ok {
+		return false
+	}
+
+	// don't set the TTL of a node reused for another key
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.live || n.key != key {
+		return false
+	}
+	s.setTTL(n, ttl)
+	return true
+}
+
+// Probe adds <key, val> if not present in the cache.
+// Returns:
+//
+//	<cached-val, true> when key is present in the cache
+//	<val, false> when key is not present in the cache
+//
+// A hit marks the entry as visited - unless the cache was created
+// with WithProbeNoBoost. With FullReject, a miss on a full cache
+// doesn't add the key.
+func (s *Sieve[K, V]) Probe(key K, val V) (V, bool) {
+
+	if v, ok := s.lookup(key); ok {
+		if val, ok := s.load(v, key); ok {
+			if s.probeNoBoost {
+				s.peek()
+				s.notify(evHit, key)
+			} else {
+				s.touch(v, key)
+			}
+			s.tune()
+			return val, true
+		}
+	}
+
+	var zero V
+
+	// another caller may have added the key since the lookup
+	s.mu.Lock()
+	n, ok := s.cache.Get(key)
+	if ok && s.expired(n) {
+		s.expire(key, n)
+		ok = false
+	}
+	if ok && !s.failed(n) {
+		v := s.value(n)
+		if s.probeNoBoost {
+			s.peek()
+		} else {
+			s.hit(n)
+			if s.policy == PolicyLRU {
+				s.promote(n)
+			}
+		}
+		s.pend(evHit, key, zero)
+		s.unlock()
+		s.tune()
+		return v, true
+	}
+
+	s.miss()
+	s.pend(evMiss, key, zero)
+	if !s.full(key) {
+		s.add(key, val)
+	}
+	s.unlock()
+	s.tune()
+	return val, false
+}
+
+// GetOrAddFunc returns the value for 'key' if present and marks it as
+// accessed; otherwise it adds the value returned by 'factory(key)'. It
+// returns true if the value was newly added. The check and the insert
+// are atomic: concurrent callers for the same missing key call
+// 'factory' exactly once and all see its result. 'factory' is called
+// with the cache lock held; it must not call back into the cache.
+func (s *Sieve[K, V]) GetOrAddFunc(key K, factory func(K) V) (V, bool) {
+	if v, ok := s.lookup(key); ok {
+		if val, ok := s.load(v, key); ok {
+			s.touch(v, key)
+			s.tune()
+			return val, false
+		}
+	}
+
+	s.mu.Lock()
+	n, ok := s.getLocked(key)
+	if ok {
+		val := s.value(n)
+		s.unlock()
+		s.tune()
+		return val, false
+	}
+
+	val := factory(key)
+	s.add(key, val)
+	s.unlock()
+	s.tune()
+	return val, true
+}
+
+// AddVisited is like Add - but sets the visited flag of the entry to
+// 'visited' instead of marking replaced entries as visited. This
+// restores the eviction priority of entries saved elsewhere. It
+// returns true if it replaced an existing entry.
+func (s *Sieve[K, V]) AddVisited(key K, val V, visited bool) bool {
+	s.mu.Lock()
+	defer s.unlock()
+
+	n, ok := s.cache.Get(key)
+	if ok {
+		n.mu.Lock()
+		old := s.store(n, val)
+		n.mu.Unlock()
+		s.replaced(key, old, val)
+		s.setTTL(n, s.ttl)
+		s.stats.replaced.Add(1)
+	} else {
+		n = s.add(key, val)
+	}
+	n.visited.Store(visited)
+
+	if ok {
+		s.trim()
+	}
+	return ok
+}
+
+// AddError caches the failure to load the value for 'key' for 'ttl';
+// this keeps callers from retrying a failing load on every lookup. A
+// zero 'ttl' caches the error until the entry is evicted or replaced.
+// The value lookups (Get, Probe, GetBatch etc.) treat a cached error as
+// a miss; GetErr and GetEntry return it. Adding a value for the key
+// replaces the error.
+func (s *Sieve[K, V]) AddError(key K, err error, ttl time.Duration) {
+	var zero V
+
+	s.mu.Lock()
+	n, ok := s.cache.Get(key)
+	if ok {
+		n.mu.Lock()
+		old := s.store(n, zero)
+		n.ext().err = err
+		n.mu.Unlock()
+		s.replaced(key, old, zero)
+		n.visited.Store(true)
+	} else {
+		n = s.add(key, zero)
+		n.mu.Lock()
+		n.ext().err = err
+		n.mu.Unlock()
+	}
+	s.setTTL(n, ttl)
+	s.unlock()
+}
+
+// GetErr is like Get - but also returns the error cached for 'key' by
+// AddError. It returns true if the key has a cached value or error.
+func (s *Sieve[K, V]) GetErr(key K) (V, error, bool) {
+	if v, ok := s.lookup(key); ok {
+		if e, ok := s.entry(v); ok && e.Key == key {
+			s.touch(v, key)
+			s.tune()
+			return e.Value, e.Err, true
+		}
+	}
+
+	s.missed(key)
+	s.tune()
+	var x V
+	return x, nil, false
+}
+
+// Preload bulk inserts the entries in 'items' - in order - under a
+// single lock. The items are expected to be ordered from oldest to
+// newest (i.e., the order in which they'd have been added) and the
+// visited flag of each entry is restored from Entry.Visited.
+// If a key occurs more than once in 'items', the last occurrence wins
+// - both its value and its position. If 'items' has more (unique) keys
+// than the cache capacity, the oldest excess entries are dropped.
+func (s *Sieve[K, V]) Preload(items []Entry[K, V]) {
+	items = dedup(items)
+
+	s.mu.Lock()
+	if len(items) > s.capacity {
+		items = items[len(items)-s.capacity:]
+	}
+
+	for i := range items {
+		e := &items[i]
+		n := s.add(e.Key, e.Value)
+		n.visited.Store(e.Visited)
+	}
+	s.trim()
+	s.unlock()
+}
+
+// ReplaceAll replaces the entire contents of the cache with 'items'
+// under a single lock: operations that take the cache lock (Snapshot,
+// Iterate, GetEach etc.) see either all of the old entries or all of
+// the new ones. A lock free lookup (Get, Probe) that races with the
+// swap may miss. The old entries are reported to the WithOnRemove
+// callback with CausePurged. 'items' is treated just like in Preload:
+// ordered from oldest to newest, with Entry.Visited restored.
+func (s *Sieve[K, V]) ReplaceAll(items []Entry[K, V]) {
+	items = dedup(items)
+
+	s.mu.Lock()
+	s.reap()
+	for x := s.head; x != nil; {
+		next := x.next
+		s.drop(x, CausePurged)
+		x = next
+	}
+
+	if len(items) > s.capacity {
+		items = items[len(items)-s.capacity:]
+	}
+	for i := range items {
+		e := &items[i]
+		n := s.add(e.Key, e.Value)
+		n.visited.Store(e.Visited)
+	}
+	s.unlock()
+}
+
+// Merge adds all the entries of 'other' to the cache - from oldest to
+// newest, evicting as needed. If a key is in both caches, its value is
+// 'onConflict(existing, incoming)'; a nil 'onConflict' keeps the
+// incoming value. Visited entries of 'other' stay visited; errors
+// cached by AddError aren't merged. 'other' is snapshotted first; so
+// it isn't locked while the cache is updated. 'onConflict' is called
+// with the cache lock held; it must not call back into the cache.
+func (s *Sieve[K, V]) Merge(other *Sieve[K, V], onConflict func(existing, incoming V) V) {
+	ents, _ := other.Snapshot()
+
+	s.mu.Lock()
+	for i := len(ents) - 1; i >= 0; i-- {
+		e := &ents[i]
+		if e.Err != nil {
+			continue
+		}
+
+		val := e.Value
+		n, ok := s.cache.Get(e.Key)
+		if ok && s.expired(n) {
+			s.expire(e.Key, n)
+			ok = false
+		}
+		if ok && onConflict != nil {
+			val = onConflict(s.value(n), e.Value)
+		}
+
+		n = s.add(e.Key, val)
+		if e.Visited {
+			n.visited.Store(true)
+		}
+	}
+	s.trim()
+	s.unlock()
+}
+
+// AddMany adds or replaces all the entries in 'items' - in order -
+// under a single lock and returns the entries evicted to make room for
+// them. Entry.Visited is ignored. If a key occurs more than once in
+// 'items', the last value wins; the cache never holds more than one
+// entry per key.
+func (s *Sieve[K, V]) AddMany(items []Entry[K, V]) []Entry[K, V] {
+	s.mu.Lock()
+	s.capture = true
+	for i := range items {
+		e := &items[i]
+		s.add(e.Key, e.Value)
+	}
+	s.trim()
+	ev := s.victims
+	s.capture, s.victims = false, nil
+	s.unlock()
+	return ev
+}
+
+// Compute atomically updates the entry for 'key'. 'fn' is called with
+// the current value and whether the key is present; it returns the new
+// value and whether to keep it. When 'keep' is true the new value is
+// stored (adding the key if necessary); otherwise the key is deleted.
+// Compute returns the new value and whether the key is in the cache
+// after the update. 'fn' is called with the cache lock held; it must
+// not call back into the cache.
+func (s *Sieve[K, V]) Compute(key K, fn func(old V, exists bool) (V, bool)) (V, bool) {
+	var old V
+
+	s.mu.Lock()
+	n, ok := s.cache.Get(key)
+	if ok && s.expired(n) {
+		s.expire(key, n)
+		ok = false
+	}
+
+	if ok {
+		n.mu.Lock()
+		old = n.val
+		n.mu.Unlock()
+	}
+
+	val, keep := fn(old, ok)
+	switch {
+	case keep && ok:
+		n.mu.Lock()
+		s.store(n, val)
+		n.mu.Unlock()
+		s.replaced(key, old, val)
+		s.setTTL(n, s.ttl)
+		n.visited.Store(true)
+		s.trim()
+	case keep:
+		s.add(key, val)
+	case ok:
+		s.drop(n, CauseDeleted)
+	}
+	s.unlock()
+	return val, keep
+}
+
+// Delete deletes the named key from the cache
+// It returns true if the item was in the cache and false otherwise
+func (s *Sieve[K, V]) Delete(key K) bool {
+	if s.rec != nil {
+		defer s.observe("delete", time.Now())
+	}
+	_, ok := s.DeleteValue(key)
+	return ok
+}
+
+// Rekey changes the key of the entry for 'oldKey' to 'newKey' while
+// retaining its value, its position in the cache and its visited state.
+// It returns false if 'oldKey' is not in the cache or if 'newKey' is;
+// expired entries are removed and count as absent.
+func (s *Sieve[K, V]) Rekey(oldKey, newKey K) bool {
+	s.mu.Lock()
+	defer s.unlock()
+
+	n, ok := s.cache.Get(oldKey)
+	if ok && s.expired(n) {
+		s.expire(oldKey, n)
+		ok = false
+	}
+	if !ok {
+		return false
+	}
+	if x, ok := s.cache.Get(newKey); ok {
+		if !s.expired(x) {
+			return false
+		}
+		s.expire(newKey, x)
+	}
+
+	n.mu.Lock()
+	if s.rindex != nil {
+		s.rindex.del(oldKey, n.val)
+		s.rindex.add(newKey, n.val)
+	}
+	n.key = newKey
+	n.mu.Unlock()
+
+	s.cache.Del(oldKey)
+	s.cache.Put(newKey, n)
+	s.gen.Add(1)
+	return true
+}
+
+// Remove is an alias for Delete
+func (s *Sieve[K, V]) Remove(key K) bool {
+	return s.Delete(key)
+}
+
+// DeleteValue deletes the named key from the cache and returns its
+// value. It returns true if the item was in the cache and false
+// otherwise.
+func (s *Sieve[K, V]) DeleteValue(key K) (V, bool) {
+	var val V
+
+	s.mu.Lock()
+	v, ok := s.cache.Get(key)
+	if ok {
+		v.mu.Lock()
+		val = v.val
+		v.mu.Unlock()
+		s.delete(v)
+	}
+	s.unlock()
+	return val, ok
+}
+
+// CompareAndDelete deletes the entry for 'key' if its value is equal
+// to 'old'. It returns true if the entry was deleted; an expired entry
+// is removed as expired and CompareAndDelete returns false.
+func CompareAndDelete[K comparable, V comparable](s *Sieve[K, V], key K, old V) bool {
+	s.mu.Lock()
+	defer s.unlock()
+
+	v, ok := s.cache.Get(key)
+	if ok && s.expired(v) {
+		s.expire(key, v)
+		ok = false
+	}
+	if !ok {
+		return false
+	}
+
+	v.mu.Lock()
+	eq := v.val == old
+	v.mu.Unlock()
+	if !eq {
+		return false
+	}
+
+	s.drop(v, CauseDeleted)
+	return true
+}
+
+// CompareAndSwap replaces the value for 'key' with 'new' if the
+// current value is equal to 'old'. It returns true if the value was
+// swapped; like Add, a swap refreshes the TTL of the entry. An expired
+// entry is absent.
+func CompareAndSwap[K comparable, V comparable](s *Sieve[K, V], key K, old, new V) bool {
+	s.mu.Lock()
+	defer s.unlock()
+
+	v, ok := s.cache.Get(key)
+	if ok && s.expired(v) {
+		s.expire(key, v)
+		ok = false
+	}
+	if !ok {
+		return false
+	}
+
+	v.mu.Lock()
+	if v.val != old {
+		v.mu.Unlock()
+		return false
+	}
+	s.store(v, new)
+	v.mu.Unlock()
+	s.replaced(key, old, new)
+
+	v.visited.Store(true)
+	s.setTTL(v, s.ttl)
+	s.trim()
+	return true
+}
+
+// AddIfChanged adds 'val' for 'key' unless the cache already holds an
+// equal value for it. An unchanged entry is left as is: it isn't marked
+// visited and its TTL isn't refreshed. It returns true if the cache was
+// updated.
+func AddIfChanged[K comparable, V comparable](s *Sieve[K, V], key K, val V) bool {
+	s.mu.Lock()
+	defer s.unlock()
+
+	n, ok := s.cache.Get(key)
+	if ok && s.expired(n) {
+		s.expire(key, n)
+		ok = false
+	}
+
+	if !ok {
+		s.add(key, val)
+		return true
+	}
+
+	n.mu.Lock()
+	if n.val == val {
+		n.mu.Unlock()
+		return false
+	}
+	old := s.store(n, val)
+	n.mu.Unlock()
+	s.replaced(key, old, val)
+
+	n.visited.Store(true)
+	s.setTTL(n, s.ttl)
+	s.trim()
+	return true
+}
+
+// DeleteMulti deletes all the keys in 'keys' under a single lock and
+// returns the number of keys that were in the cache. With
+// WithTombstones, the deleted entries are only unlinked from the list
+// later.
+func (s *Sieve[K, V]) DeleteMulti(keys []K) int {
+	var n int
+
+	s.mu.Lock()
+	for _, k := range keys {
+		if v, ok := s.cache.Get(k); ok {
+			s.delete(v)
+			n++
+		}
+	}
+	s.unlock()
+	return n
+}
+
+// DeleteMatching deletes all the keys for which 'match' returns true.
+// It walks the cache once and returns the number of deleted entries.
+// The match function is called with the cache lock held; it must not
+// call back into the cache.
+func (s *Sieve[K, V]) DeleteMatching(match func(key K) bool) int {
+	var n int
+
+	s.mu.Lock()
+	s.reap()
+	for x := s.head; x != nil; {
+		next := x.next
+		if match(x.key) {
+			s.drop(x, CauseDeleted)
+			n++
+		}
+		x = next
+	}
+	s.unlock()
+	return n
+}
+
+// Drain removes every entry from the cache in SIEVE eviction order
+// and calls 'fn' for each of them. The entries are removed under a
+// single lock and 'fn' is called after the lock is released. Drained
+// entries are not counted as evictions.
+func (s *Sieve[K, V]) Drain(fn func(key K, val V)) {
+	s.mu.Lock()
+	items := make([]Entry[K, V], 0, s.size)
+	for s.size > 0 {
+		n, _ := s.sweep()
+		n.mu.Lock()
+		items = append(items, Entry[K, V]{Key: n.key, Value: n.val})
+		n.mu.Unlock()
+		s.drop(n, CauseDeleted)
+	}
+	s.unlock()
+
+	for i := range items {
+		e := &items[i]
+		fn(e.Key, e.Value)
+	}
+}
+
+// Purge resets the cache
+func (s *Sieve[K, V]) Purge() {
+	s.mu.Lock()
+	s.reap()
+	for x := s.head; x != nil; {
+		next := x.next
+		s.queue(x, CausePurged)
+		s.free(x)
+		x = next
+	}
+	s.cache = s.newMap()
+	s.head = nil
+	s.tail = nil
+	s.hand = nil
+	s.size = 0
+	s.stats.bytes.Store(0)
+	s.gen.Add(1)
+	if s.rindex != nil {
+		s.rindex.reset()
+	}
+	s.unlock()
+}
+
+// ShrinkToFit sets the capacity of the cache to its current size
+// and rebuilds the internal map to release the memory held after a
+// burst of entries has come and gone. An empty cache is shrunk to a
+// capacity of 1.
+func (s *Sieve[K, V]) ShrinkToFit() {
+	s.mu.Lock()
+	s.rebuild()
+	s.capacity = max(s.size, 1)
+	s.unlock()
+}
+
+// EvictN evicts up to 'n' entries in SIEVE eviction order - just as
+// if 'n' new entries were added - and returns the number of entries
+// evicted; this is fewer than 'n' if the cache holds fewer entries.
+// This frees up room ahead of a burst of inserts.
+func (s *Sieve[K, V]) EvictN(n int) int {
+	s.mu.Lock()
+	size := s.size
+	for i := 0; i < n && s.size > 0; i++ {
+		s.evict()
+	}
+	n = size - s.size
+	s.unlock()
+	return n
+}
+
+// Compact removes expired entries and tombstones (see WithTombstones)
+// and rebuilds the internal map from the remaining entries - releasing
+// the backing store the map retains after heavy churn. Unlike
+// ShrinkToFit, the capacity is unchanged. The order of the entries,
+// their visited flags and the eviction hand are preserved.
+func (s *Sieve[K, V]) Compact() {
+	s.mu.Lock()
+	s.removeExpired()
+	s.rebuild()
+	s.unlock()
+}
+
+// RemoveExpired removes all the entries past their TTL in a single
+// pass and returns the number of entries removed. Expired entries are
+// otherwise removed lazily - when they're next accessed or evicted;
+// this lets callers reclaim them at a time of their choosing. The
+// WithOnRemove callback is called with CauseExpired for each of them.
+func (s *Sieve[K, V]) RemoveExpired() int {
+	s.mu.Lock()
+	n := s.removeExpired()
+	s.unlock()
+	return n
+}
+
+// Resize changes the max capacity of the cache to 'capacity'. If the
+// cache holds more entries than the new capacity, the excess entries
+// are evicted per the SIEVE algorithm.
+func (s *Sieve[K, V]) Resize(capacity int) {
+	s.mu.Lock()
+	s.resize(capacity)
+	s.unlock()
+}
+
+// SetMaxEntries is an alias for Resize: it sets the maximum number of
+// live entries the cache holds to 'n'.
+func (s *Sieve[K, V]) SetMaxEntries(n int) {
+	s.Resize(n)
+}
+
+// ResizeKeepVisited is like Resize - but when shrinking, it evicts all
+// the unvisited entries (in SIEVE order) before any visited entry and
+// leaves the visited flags as is; if it must evict visited entries, it
+// evicts them in the order the hand reaches them. Resize clears the
+// flags as its hand passes over them - and then evicts those entries
+// once it runs out of unvisited entries. Keeping the visited entries
+// retains the hot set; but it also keeps entries that were hot in the
+// past regardless of how long ago they were accessed.
+func (s *Sieve[K, V]) ResizeKeepVisited(capacity int) {
+	s.mu.Lock()
+	s.reap()
+	capacity = max(capacity, 1)
+	if excess := s.size - capacity; excess > 0 {
+		victims, scan := s.unvisited(excess)
+		for _, n := range victims {
+			s.retire(n)
+		}
+		s.stats.scans.Add(uint64(scan))
+	}
+
+	// only visited entries are left; evict them in hand order
+	for s.size > capacity {
+		n := s.hand
+		if n == nil {
+			n = s.handStart()
+		}
+		if s.trace != nil {
+			s.trace(EvictTrace[K]{Key: n.key, Visited: n.visited.Load(), Evicted: true})
+		}
+		s.retire(n)
+	}
+	s.capacity = capacity
+	s.unlock()
+}
+
+// Len returns the current cache utilization
+func (s *Sieve[K, V]) Len() int {
+	return s.size
+}
+
+// Cap returns the max cache capacity. The capacity is the maximum
+// number of live entries the cache holds before it evicts; it is not
+// a bound on memory (see WithWeigher) nor the capacity of the
+// underlying map.
+func (s *Sieve[K, V]) Cap() int {
+	return s.capacity
+}
+
+// MaxEntries is an alias for Cap: it returns the maximum number of
+// live entries the cache holds.
+func (s *Sieve[K, V]) MaxEntries() int {
+	return s.Cap()
+}
+
+// TopN returns up to 'n' keys with the most hits - in descending
+// order of hits. It returns nil if the cache wasn't created with
+// NewWithHitCount.
+func (s *Sieve[K, V]) TopN(n int) []KeyCount[K] {
+	if !s.countHits || n <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	s.reap()
+	kc := make([]KeyCount[K], 0, s.size)
+	for x, i := s.head, 0; x != nil && i < s.size; x, i = x.next, i+1 {
+		kc = append(kc, KeyCount[K]{x.key, x.ext().hits.Load()})
+	}
+	s.unlock()
+
+	sort.Slice(kc, func(i, j int) bool {
+		return kc[i].Hits > kc[j].Hits
+	})
+
+	if len(kc) > n {
+		kc = kc[:n]
+	}
+	return kc
+}
+
+// EvictionOrder returns the keys in the cache in the order in which
+// they'd be evicted by the SIEVE algorithm - given the current visited
+// state and hand position. It doesn't modify the cache.
+func (s *Sieve[K, V]) EvictionOrder() []K {
+	s.mu.Lock()
+	keys := s.evictionOrder(s.size)
+	s.unlock()
+	return keys
+}
+
+// SortedEntries returns a snapshot of all the entries in the cache
+// sorted by 'less'; entries that compare equal stay in the order from
+// newest to oldest. The snapshot is taken under the cache lock and
+// sorted after it is released. This is O(n log n) and meant for
+// occasional reporting - not the hot path. It doesn't mark the entries
+// as visited.
+func (s *Sieve[K, V]) SortedEntries(less func(a, b Entry[K, V]) bool) []Entry[K, V] {
+	ents, _ := s.Snapshot()
+	sort.SliceStable(ents, func(i, j int) bool {
+		return less(ents[i], ents[j])
+	})
+	return ents
+}
+
+// VisitedCount returns the number of entries currently marked as
+// visited. A high fraction of visited entries means most entries are
+// protected from the next eviction - and the hand will have to clear
+// many flags to find a victim. It walks the entire list under the
+// cache lock.
+func (s *Sieve[K, V]) VisitedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reap()
+
+	var v int
+	for n, i := s.head, 0; n != nil && i < s.size; n, i = n.next, i+1 {
+		if n.visited.Load() {
+			v++
+		}
+	}
+	return v
+}
+
+// IsHand returns true if the eviction hand points to the entry for
+// 'key' - i.e., the next eviction starts its scan there. It returns
+// false if the hand isn't set; the next eviction then starts at the
+// tail - or at the head with HandFromHead.
+func (s *Sieve[K, V]) IsHand(key K) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reap()
+	return s.hand != nil && s.hand.key == key
+}
+
+// LastEvicted returns the key of the most recent eviction and whether
+// any entry has been evicted yet. Only evictions to make room count -
+// not deletes or expiry.
+func (s *Sieve[K, V]) LastEvicted() (K, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastEvicted, s.evicted
+}
+
+// ColdestN returns up to 'n' keys that would be evicted soonest - in
+// eviction order. Like EvictionOrder, it only simulates the hand and
+// doesn't modify the visited flags; but it stops after 'n' victims.
+func (s *Sieve[K, V]) ColdestN(n int) []K {
+	s.mu.Lock()
+	keys := s.evictionOrder(n)
+	s.unlock()
+	return keys
+}
+
+// Cursor tracks the position of a paginated iteration over the cache
+// (see Iterate). The zero value starts a new iteration.
+type Cursor[K comparable] struct {
+	keys    []K
+	started bool
+}
+
+// Iterate returns up to 'n' entries starting at cursor 'c', the cursor
+// to resume from and true if the iteration is complete. The keys are
+// snapshotted when the iteration starts (with a zero cursor) and the
+// lock is only held for the duration of each call; entries removed
+// after the snapshot are skipped and entries added after it are not
+// visited. Iterate doesn't mark the entries as visited.
+func (s *Sieve[K, V]) Iterate(c Cursor[K], n int) ([]Entry[K, V], Cursor[K], bool) {
+	if !c.started {
+		s.mu.Lock()
+		c.keys = s.keys()
+		c.started = true
+		s.mu.Unlock()
+	}
+
+	var out []Entry[K, V]
+
+	s.mu.Lock()
+	for len(out) < n && len(c.keys) > 0 {
+		k := c.keys[0]
+		c.keys = c.keys[1:]
+
+		x, ok := s.cache.Get(k)
+		if !ok || s.expired(x) {
+			continue
+		}
+		e, _ := s.entry(x)
+		out = append(out, e)
+	}
+	s.mu.Unlock()
+	return out, c, len(c.keys) == 0
+}
+
+// Generation returns a counter that is incremented on every change to
+// the contents of the cache: adds, value updates, deletes, evictions
+// and purges. Lookups don't advance it. Comparing two generations
+// tells if the cache changed in between.
+func (s *Sieve[K, V]) Generation() uint64 {
+	return s.gen.Load()
+}
+
+// Snapshot returns all the entries in the cache - from newest to
+// oldest - and the generation of the cache at the time of the
+// snapshot; both are taken under a single lock. If a later call to
+// Generation returns the same value, the snapshot is still current.
+// Snapshot doesn't mark the entries as visited.
+func (s *Sieve[K, V]) Snapshot() ([]Entry[K, V], uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reap()
+
+	out := make([]Entry[K, V], 0, s.size)
+	for n, i := s.head, 0; n != nil && i < s.size; n, i = n.next, i+1 {
+		if !s.expired(n) {
+			e, _ := s.entry(n)
+			out = append(out, e)
+		}
+	}
+	return out, s.gen.Load()
+}
+
+// Keys returns the keys of all the entries in the cache - from newest
+// to oldest. It doesn't mark the entries as visited.
+func (s *Sieve[K, V]) Keys() []K {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reap()
+
+	keys := make([]K, 0, s.size)
+	for n, i := s.head, 0; n != nil && i < s.size; n, i = n.next, i+1 {
+		if !s.expired(n) {
+			keys = append(keys, n.key)
+		}
+	}
+	return keys
+}
+
+// KeysChan returns a channel that yields the keys returned by Keys -
+// one at a time - and is closed after the last one. The keys are
+// snapshotted under the cache lock; the lock isn't held while they're
+// sent. The caller must drain the channel; otherwise the goroutine
+// sending the keys leaks.
+func (s *Sieve[K, V]) KeysChan() <-chan K {
+	keys := s.Keys()
+	ch := make(chan K)
+	go func() {
+		for _, k := range keys {
+			ch <- k
+		}
+		close(ch)
+	}()
+	return ch
+}
+
+// String returns a concise summary of the cache - its type, size,
+// capacity and hit/miss counts - without any of its entries; it is
+// safe to use in log statements regardless of the cache size. Use
+// Dump to see the entries.
+func (s *Sieve[K, V]) String() string {
+	s.mu.Lock()
+	size, capacity := s.size, s.capacity
+	s.unlock()
+
+	typ := strings.TrimPrefix(fmt.Sprintf("%T", s), "*sieve.")
+	return fmt.Sprintf("%s{size=%d cap=%d hits=%d misses=%d}", typ,
+		size, capacity, s.stats.hits.Load(), s.stats.misses.Load())
+}
+
+// Dump dumps all the cache contents as a newline delimited
+// string. It walks at most Len entries - so it terminates even if the
+// list is corrupt - and flags a list longer than that.
+func (s *Sieve[K, V]) Dump() string {
+	var b strings.Builder
+
+	s.mu.Lock()
+	s.reap()
+	b.WriteString(s.desc())
+	b.WriteRune('\n')
+
+	// stop after 'size' nodes; so a corrupt list can't loop forever
+	n := s.head
+	for i := 0; n != nil && i < s.size; i++ {
+		h := "  "
+		if n == s.hand {
+			h = ">>"
+		}
+		n.mu.Lock()
+		b.WriteString(fmt.Sprintf("%svisited=%v, key=%v, val=%v\n", h, n.visited.Load(), n.key, n.val))
+		n.mu.Unlock()
+		n = n.next
+	}
+	if n != nil {
+		b.WriteString(fmt.Sprintf("!! list is longer than size %d; corrupt cache\n", s.size))
+	}
+	s.unlock()
+	return b.String()
+}
+
+// -- internal methods --
+
+// addTTL adds or replaces an entry with the given TTL
+func (s *Sieve[K, V]) addTTL(key K, val V, ttl time.Duration) AddResult {
+	if v, ok := s.cache.Get(key); ok {
+		// the node may have been removed - and reused for another key
+		// - since the lookup; if so, take the locked path below.
+		v.mu.Lock()
+		if !v.live || v.key != key {
+			v.mu.Unlock()
+			return s.addLocked(key, val, ttl)
+		}
+		old := s.store(v, val)
+		s.setTTL(v, ttl)
+		v.visited.Store(true)
+		v.mu.Unlock()
+		s.stats.replaced.Add(1)
+
+		// we don't hold the cache lock; so call back right away
+		if s.onReplace != nil {
+			s.onReplace(key, old, val)
+		}
+
+		// the new value may have pushed us over the weight budget
+		if s.maxWeight > 0 && s.stats.bytes.Load() > s.maxWeight {
+			s.mu.Lock()
+			s.trim()
+			s.unlock()
+		}
+		return AddReplaced
+	}
+	return s.addLocked(key, val, ttl)
+}
+
+// addLocked adds or replaces 'key' with the cache lock held; it
+// returns AddRejected if the cache is full and rejects new keys.
+func (s *Sieve[K, V]) addLocked(key K, val V, ttl time.Duration) AddResult {
+	s.mu.Lock()
+	if s.full(key) {
+		s.unlock()
+		return AddRejected
+	}
+
+	r := AddInserted
+	if _, ok := s.cache.Get(key); ok {
+		r = AddReplaced
+	}
+	n := s.add(key, val)
+	s.setTTL(n, ttl)
+	s.trim()
+	s.unlock()
+	return r
+}
+
+// full returns true if adding 'key' must be rejected because the
+// cache is full and configured with FullReject.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) full(key K) bool {
+	if !s.reject || s.size < s.capacity || s.capacity < s.growMax {
+		return false
+	}
+	_, ok := s.cache.Get(key)
+	return !ok
+}
+
+// lookup finds the node for 'key'; expired nodes are removed and
+// treated as absent.
+func (s *Sieve[K, V]) lookup(key K) (*Node[K, V], bool) {
+	n, ok := s.cache.Get(key)
+	if ok && s.expired(n) {
+		s.mu.Lock()
+		s.expire(key, n)
+		s.unlock()
+		return nil, false
+	}
+	return n, ok
+}
+
+// failed returns true if the node holds a cached error
+func (s *Sieve[K, V]) failed(n *Node[K, V]) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.loadErr() != nil
+}
+
+// getLocked is like Get - but with the lock held and returns the
+// node. It records the hit or miss.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) getLocked(key K) (*Node[K, V], bool) {
+	n, ok := s.cache.Get(key)
+	if ok && s.expired(n) {
+		s.expire(key, n)
+		ok = false
+	}
+	if ok && s.failed(n) {
+		ok = false
+	}
+
+	var zero V
+	if ok {
+		s.hit(n)
+		s.pend(evHit, key, zero)
+		if s.policy == PolicyLRU {
+			s.promote(n)
+		}
+	} else {
+		s.miss()
+		s.pend(evMiss, key, zero)
+	}
+	return n, ok
+}
+
+// expired returns true if the node has outlived its TTL
+func (s *Sieve[K, V]) expired(n *Node[K, V]) bool {
+	x := n.x.Load()
+	if x == nil {
+		return false
+	}
+	exp := x.expires.Load()
+	return exp != 0 && s.clock.Now().UnixNano() > exp
+}
+
+// expire removes the node for 'key' if it is still in the cache and
+// has expired.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) expire(key K, n *Node[K, V]) {
+	if x, ok := s.cache.Get(key); ok && x == n && s.expired(n) {
+		s.drop(n, CauseExpired)
+		s.stats.expired.Add(1)
+	}
+}
+
+// setTTL sets the TTL of a node and its expiry deadline
+func (s *Sieve[K, V]) setTTL(n *Node[K, V], ttl time.Duration) {
+	// a node without a TTL needs no metadata
+	x := n.x.Load()
+	if x == nil {
+		if ttl <= 0 {
+			return
+		}
+		x = n.ext()
+	}
+	x.ttl.Store(int64(ttl))
+	x.expires.Store(s.deadline(ttl))
+}
+
+// deadline returns the expiry time for a TTL of 'ttl' from now
+func (s *Sieve[K, V]) deadline(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return s.clock.Now().Add(ttl).UnixNano()
+}
+
+// unlock releases the cache lock and runs the eviction callback for
+// the entries evicted while the lock was held. Running the callback
+// outside the lock lets it safely call back into the cache.
+func (s *Sieve[K, V]) unlock() {
+	if len(s.pending) == 0 {
+		s.mu.Unlock()
+		return
+	}
+
+	p := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	for i := range p {
+		r := &p[i]
+		switch r.kind {
+		case evReplace:
+			s.onReplace(r.Key, r.old, r.Value)
+		case evRemove:
+			if s.onEvict != nil && r.cause == CauseEvicted {
+				s.onEvict(r.Key, r.Value)
+			}
+			if s.onRemove != nil {
+				s.onRemove(r.Key, r.Value, r.cause)
+			}
+			s.observeRemove(r)
+			if s.autoClose {
+				if c, ok := any(r.Value).(io.Closer); ok {
+					c.Close()
+				}
+			}
+		default:
+			s.notifyEntry(r.kind, r.Key, r.Value)
+		}
+	}
+}
+
+// notify calls the observer for a lookup of 'key'
+func (s *Sieve[K, V]) notify(kind eventKind, key K) {
+	var zero V
+	s.notifyEntry(kind, key, zero)
+}
+
+// notifyEntry calls the observer for an insert or a lookup
+func (s *Sieve[K, V]) notifyEntry(kind eventKind, key K, val V) {
+	o := s.obs
+	if o == nil {
+		return
+	}
+
+	switch {
+	case kind == evInsert && o.OnInsert != nil:
+		o.OnInsert(key, val)
+	case kind == evHit && o.OnHit != nil:
+		o.OnHit(key)
+	case kind == evMiss && o.OnMiss != nil:
+		o.OnMiss(key)
+	}
+}
+
+// observeRemove calls the observer for an entry that left the cache
+func (s *Sieve[K, V]) observeRemove(r *event[K, V]) {
+	o := s.obs
+	if o == nil {
+		return
+	}
+
+	if r.cause == CauseEvicted {
+		if o.OnEvict != nil {
+			o.OnEvict(r.Key, r.Value)
+		}
+	} else if o.OnDelete != nil {
+		o.OnDelete(r.Key, r.Value)
+	}
+}
+
+// pend queues an insert or lookup event for the observer; it runs
+// when the lock is released.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) pend(kind eventKind, key K, val V) {
+	if s.obs != nil {
+		s.pending = append(s.pending, event[K, V]{
+			Entry: Entry[K, V]{Key: key, Value: val},
+			kind:  kind,
+		})
+	}
+}
+
+// touch marks the node of 'key' as accessed on a cache hit; with the
+// LRU policy, it also takes the lock to move the node to the head.
+// NB: Caller must not hold the lock
+func (s *Sieve[K, V]) touch(n *Node[K, V], key K) {
+	s.hit(n)
+	s.notify(evHit, key)
+	if s.policy == PolicyLRU {
+		s.mu.Lock()
+		s.promote(n)
+		s.mu.Unlock()
+	}
+}
+
+// hit records a cache hit on a node
+func (s *Sieve[K, V]) hit(n *Node[K, V]) {
+	s.stats.hits.Add(1)
+	if s.window != nil {
+		s.window.record(true)
+	}
+
+	// avoid dirtying the cache line if the node is already visited
+	if !n.visited.Load() {
+		n.visited.Store(true)
+	}
+	if s.countHits {
+		n.ext().hits.Add(1)
+	}
+	if s.policy == PolicyFrequency {
+		n.bump()
+		s.freqHits.Add(1)
+	}
+	if s.sliding {
+		if x := n.x.Load(); x != nil {
+			if ttl := x.ttl.Load(); ttl > 0 {
+				x.expires.Store(s.deadline(time.Duration(ttl)))
+			}
+		}
+	}
+}
+
+// peek records a cache hit without marking the node as accessed
+func (s *Sieve[K, V]) peek() {
+	s.stats.hits.Add(1)
+	if s.window != nil {
+		s.window.record(true)
+	}
+}
+
+// miss records a cache miss
+func (s *Sieve[K, V]) miss() {
+	s.stats.misses.Add(1)
+	if s.window != nil {
+		s.window.record(false)
+	}
+}
+
+// missed records a cache miss of 'key' and tells the observer.
+// NB: Caller must not hold the lock
+func (s *Sieve[K, V]) missed(key K) {
+	s.miss()
+	s.notify(evMiss, key)
+}
+
+// add a new tuple to the cache and evict as necessary
+// caller must hold lock.
+func (s *Sieve[K, V]) add(key K, val V) *Node[K, V] {
+	var sz int64
+
+	// we may have raced with another writer adding the same key; the
+	// caller trims the cache if the new value is heavier.
+	if n, ok := s.cache.Get(key); ok {
+		n.mu.Lock()
+		old := s.store(n, val)
+		n.mu.Unlock()
+		s.replaced(key, old, val)
+		s.setTTL(n, s.ttl)
+		n.visited.Store(true)
+		s.stats.replaced.Add(1)
+		return n
+	}
+
+	if s.sizer != nil {
+		sz = s.sizer(key, val)
+	}
+
+	// tombstones hold their slot until the cache fills up
+	if s.size+len(s.tombs) >= s.capacity {
+		s.reap()
+	}
+
+	// grow instead of evicting while we can
+	if s.size >= s.capacity && s.capacity < s.growMax {
+		s.capacity = min(2*s.capacity, s.growMax)
+	}
+
+	// cache miss; we evict and fnd a new node
+	if s.size >= s.capacity {
+		for i := max(s.batch, 1); i > 0 && s.size > 0; i-- {
+			s.evict()
+		}
+	}
+
+	// and make room for the new entry's weight
+	if s.maxWeight > 0 {
+		for s.size > 0 && s.stats.bytes.Load()+sz > s.maxWeight {
+			s.evict()
+		}
+	}
+
+	n := s.newNode(key, val, sz)
+	s.stats.inserts.Add(1)
+	s.pend(evInsert, key, val)
+	if s.rindex != nil {
+		s.rindex.add(key, val)
+	}
+
+	// Eviction is guaranteed to remove one node; so this should never happen.
+	if n == nil {
+		msg := fmt.Sprintf("%T: add <%v>: objpool empty after eviction", s, key)
+		panic(msg)
+	}
+
+	if s.sizer != nil {
+		s.stats.bytes.Add(sz)
+	}
+	s.cache.Put(key, n)
+	s.setTTL(n, s.ttl)
+
+	if s.insertAtTail {
+		s.insertAtHand(n)
+	} else {
+		s.insertHead(n)
+	}
+
+	s.size += 1
+	s.gen.Add(1)
+	return n
+}
+
+// insert a node at the head of the list
+func (s *Sieve[K, V]) insertHead(n *Node[K, V]) {
+	n.next = s.head
+	n.prev = nil
+	if s.head != nil {
+		s.head.prev = n
+	}
+	s.head = n
+	if s.tail == nil {
+		s.tail = n
+	}
+}
+
+// promote moves a node to the head of the list; it is a no-op if the
+// node was removed from the cache since it was looked up.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) promote(n *Node[K, V]) {
+	if x, ok := s.cache.Get(n.key); !ok || x != n || s.head == n {
+		return
+	}
+
+	n.prev.next = n.next
+	if n.next != nil {
+		n.next.prev = n.prev
+	} else {
+		s.tail = n.prev
+	}
+	s.insertHead(n)
+}
+
+// insert a node where the hand will look next; this is where the hand
+// starts when it isn't set.
+func (s *Sieve[K, V]) insertAtHand(n *Node[K, V]) {
+	h := s.hand
+	if h == nil && s.handHead {
+		s.insertHead(n)
+		return
+	}
+	if h == nil {
+		n.prev = s.tail
+		n.next = nil
+		if s.tail != nil {
+			s.tail.next = n
+		}
+		s.tail = n
+		if s.head == nil {
+			s.head = n
+		}
+		return
+	}
+
+	if s.handHead {
+		// the hand moves toward the tail; so slot the new node
+		// behind it
+		n.next = h
+		n.prev = h.prev
+		if h.prev != nil {
+			h.prev.next = n
+		} else {
+			s.head = n
+		}
+		h.prev = n
+		s.hand = n
+		return
+	}
+
+	// the hand moves toward the head; so slot the new node behind it
+	n.prev = h
+	n.next = h.next
+	if h.next != nil {
+		h.next.prev = n
+	} else {
+		s.tail = n
+	}
+	h.next = n
+	s.hand = n
+}
+
+// entry returns a snapshot of a node and false if the node was
+// removed from the cache.
+func (s *Sieve[K, V]) entry(n *Node[K, V]) (Entry[K, V], bool) {
+	n.mu.Lock()
+	e := Entry[K, V]{
+		Key:     n.key,
+		Value:   n.val,
+		Visited: n.visited.Load(),
+		Err:     n.loadErr(),
+	}
+	if s.countHits {
+		x := n.ext()
+		e.Hits = x.hits.Load()
+		e.Age = s.clock.Now().Sub(x.added)
+	}
+	live := n.live
+	n.mu.Unlock()
+
+	if s.clone != nil {
+		e.Value = s.clone(e.Value)
+	}
+	return e, live
+}
+
+// keys returns the keys in the cache from head to tail
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) keys() []K {
+	s.reap()
+	keys := make([]K, 0, s.size)
+	for x, i := s.head, 0; x != nil && i < s.size; x, i = x.next, i+1 {
+		keys = append(keys, x.key)
+	}
+	return keys
+}
+
+// observe records the latency of an operation that began at 'start'
+func (s *Sieve[K, V]) observe(op string, start time.Time) {
+	s.rec.Observe(op, time.Since(start))
+}
+
+// load returns the value of a node found by a lock free lookup of
+// 'key' - cloned if the cache has a value cloner. It returns false if
+// the node holds a cached error or if it was removed (and possibly
+// reused for another key) since the lookup.
+func (s *Sieve[K, V]) load(n *Node[K, V], key K) (V, bool) {
+	n.mu.Lock()
+	v := n.val
+	ok := n.live && n.key == key && n.loadErr() == nil
+	n.mu.Unlock()
+
+	if !ok {
+		var z V
+		return z, false
+	}
+	if s.clone != nil {
+		return s.clone(v), true
+	}
+	return v, true
+}
+
+// value returns the value of a node - cloned if the cache has a
+// value cloner. The value is read under the node lock as it may be
+// concurrently replaced.
+// NB: Caller must hold the cache lock; lock free readers use load
+func (s *Sieve[K, V]) value(n *Node[K, V]) V {
+	n.mu.Lock()
+	v := n.val
+	n.mu.Unlock()
+
+	if s.clone != nil {
+		return s.clone(v)
+	}
+	return v
 }
 
-// New creates a new cache of size 'capacity' mapping key 'K' to value 'V'
-func New[K comparable, V any](capacity int) *Sieve[K, V] {
-	s := &Sieve[K, V]{
-		cache:    newSyncMap[K, *node[K, V]](),
-		capacity: capacity,
-		pool:     newSyncPool[node[K, V]](),
+// store updates the value of a node and returns the old value
+// NB: Caller must hold the node lock
+func (s *Sieve[K, V]) store(n *Node[K, V], val V) V {
+	old := n.val
+	if s.rindex != nil {
+		s.rindex.update(n.key, old, val)
 	}
-	return s
+	n.val = val
+	n.clearErr()
+	s.gen.Add(1)
+	if s.sizer != nil {
+		x := n.ext()
+		sz := s.sizer(n.key, val)
+		s.stats.bytes.Add(sz - x.size)
+		x.size = sz
+	}
+	return old
 }
 
-// Get fetches the value for a given key in the cache.
-// It returns true if the key is in the cache, false otherwise.
-// The zero value for 'V' is returned when key is not in the cache.
-func (s *Sieve[K, V]) Get(key K) (V, bool) {
+// evict an item from the cache.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) evict() {
+	n, scan := s.sweep()
+	if n == nil {
+		return
+	}
 
-	if v, ok := s.cache.Get(key); ok {
-		v.visited.Store(true)
-		return v.val, true
+	s.retire(n)
+	s.stats.scans.Add(uint64(scan))
+}
+
+// retire removes an eviction victim and records the eviction
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) retire(n *Node[K, V]) {
+	s.lastEvicted, s.evicted = n.key, true
+	if s.capture {
+		n.mu.Lock()
+		s.victims = append(s.victims, Entry[K, V]{Key: n.key, Value: n.val})
+		n.mu.Unlock()
 	}
+	s.drop(n, CauseEvicted)
+	s.stats.evictions.Add(1)
+}
 
-	var x V
-	return x, false
+// drop removes a node from the map and the list and queues the
+// removal callbacks.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) drop(n *Node[K, V], cause Cause) {
+	s.queue(n, cause)
+	s.cache.Del(n.key)
+	s.remove(n)
 }
 
-// Add adds a new element to the cache or overwrite one if it exists
-// Return true if we replaced, false otherwise
-func (s *Sieve[K, V]) Add(key K, val V) bool {
+// queue records the removal of a node for the callbacks that run when
+// the lock is released.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) queue(n *Node[K, V], cause Cause) {
+	if s.onRemove == nil && s.obs == nil && !s.autoClose && (s.onEvict == nil || cause != CauseEvicted) {
+		return
+	}
 
-	if v, ok := s.cache.Get(key); ok {
-		v.visited.Store(true)
-		v.Lock()
-		v.val = val
-		v.Unlock()
-		return true
+	n.mu.Lock()
+	s.pending = append(s.pending, event[K, V]{
+		Entry: Entry[K, V]{Key: n.key, Value: n.val},
+		cause: cause,
+	})
+	n.mu.Unlock()
+}
+
+// replaced records the replacement of the value of 'key' for the
+// callback that runs when the lock is released.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) replaced(key K, old, val V) {
+	if s.onReplace != nil {
+		s.pending = append(s.pending, event[K, V]{
+			Entry: Entry[K, V]{Key: key, Value: val},
+			old:   old,
+			kind:  evReplace,
+		})
 	}
+}
 
-	s.mu.Lock()
-	s.add(key, val)
-	s.mu.Unlock()
-	return false
+// event is an entry that left the cache and the reason it left - or
+// an entry that was inserted, replaced (by Value) or looked up; as
+// given by 'kind'.
+type event[K comparable, V any] struct {
+	Entry[K, V]
+	kind  eventKind
+	cause Cause
+	old   V
 }
 
-// Probe adds <key, val> if not present in the cache.
-// Returns:
-//
-//	<cached-val, true> when key is present in the cache
-//	<val, false> when key is not present in the cache
-func (s *Sieve[K, V]) Probe(key K, val V) (V, bool) {
+// eventKind is the type of a cache event
+type eventKind int
 
-	if v, ok := s.cache.Get(key); ok {
-		v.visited.Store(true)
-		return v.val, true
+const (
+	evRemove eventKind = iota
+	evReplace
+	evInsert
+	evHit
+	evMiss
+)
+
+// sweep moves the hand to the next eviction victim - clearing the
+// visited flags along the way - and returns the victim and the number
+// of flags cleared. The hand is left at the victim's predecessor; the
+// caller must remove the victim. Since every flag the hand passes is
+// cleared, it examines at most size+1 nodes: when every entry is
+// visited, it evicts the node it started at after one full lap.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) sweep() (*Node[K, V], int) {
+	var scan int
+
+	s.reap()
+	switch s.policy {
+	case PolicyFrequency:
+		return s.sweepFreq()
+	case PolicyFIFO, PolicyLRU:
+		// FIFO and LRU evict the tail; the hand isn't used
+		return s.tail, 0
 	}
 
-	s.mu.Lock()
-	s.add(key, val)
-	s.mu.Unlock()
-	return val, false
+	hand := s.hand
+	if hand == nil {
+		hand = s.handStart()
+	}
+
+	for hand != nil {
+		visited := hand.visited.Load()
+		if s.trace != nil {
+			s.trace(EvictTrace[K]{Key: hand.key, Visited: visited, Evicted: !visited, Scan: scan})
+		}
+		if !visited {
+			s.hand = s.ahead(hand)
+			return hand, scan
+		}
+		hand.visited.Store(false)
+		scan++
+		hand = s.ahead(hand)
+		// wrap around and start again
+		if hand == nil {
+			hand = s.handStart()
+		}
+	}
+	s.hand = hand
+	return nil, scan
 }
 
-// Delete deletes the named key from the cache
-// It returns true if the item was in the cache and false otherwise
-func (s *Sieve[K, V]) Delete(key K) bool {
+// sweepFreq is the sweep for PolicyFrequency: the hand clears visited
+// flags like SIEVE, but it collects up to freqSample distinct unvisited
+// entries and picks the one with the lowest access count as the victim.
+// Since the flags it passes are cleared, it examines at most two laps
+// worth of nodes.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) sweepFreq() (*Node[K, V], int) {
+	var cand [freqSample]*Node[K, V]
+	var victim *Node[K, V]
+	var scan, nc int
 
-	if v, ok := s.cache.Del(key); ok {
-		s.mu.Lock()
-		s.remove(v)
-		s.mu.Unlock()
-		return true
+	s.age()
+
+	hand := s.hand
+	if hand == nil {
+		hand = s.handStart()
+	}
+
+	want := min(freqSample, s.size)
+	for hand != nil && nc < want {
+		if hand.visited.Load() {
+			if s.trace != nil {
+				s.trace(EvictTrace[K]{Key: hand.key, Visited: true, Scan: scan})
+			}
+			hand.visited.Store(false)
+			scan++
+		} else if !slices.Contains(cand[:nc], hand) {
+			cand[nc] = hand
+			nc++
+			if victim == nil || hand.ext().freq.Load() < victim.ext().freq.Load() {
+				victim = hand
+			}
+		}
+
+		hand = s.ahead(hand)
+		if hand == nil {
+			hand = s.handStart()
+		}
+	}
+
+	if victim == nil {
+		s.hand = hand
+		return nil, scan
 	}
 
-	return false
+	if s.trace != nil {
+		for _, n := range cand[:nc] {
+			s.trace(EvictTrace[K]{Key: n.key, Evicted: n == victim, Scan: scan})
+		}
+	}
+	s.hand = s.ahead(victim)
+	return victim, scan
 }
 
-// Purge resets the cache
-func (s *Sieve[K, V]) Purge() {
-	s.mu.Lock()
-	s.cache = newSyncMap[K, *node[K, V]]()
-	s.head = nil
-	s.tail = nil
-	s.mu.Unlock()
+// age halves the access counters of every entry once enough hits
+// have accumulated since they were last aged.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) age() {
+	if s.freqHits.Load() < uint64(freqAge*s.capacity) {
+		return
+	}
+
+	s.freqHits.Store(0)
+	n := s.head
+	for i := 0; n != nil && i < s.size; i++ {
+		f := &n.ext().freq
+		f.Store(f.Load() / 2)
+		n = n.next
+	}
 }
 
-// Len returns the current cache utilization
-func (s *Sieve[K, V]) Len() int {
-	return s.size
+// bump increments the access counter of a node - saturating at freqMax
+func (n *Node[K, V]) bump() {
+	x := n.ext()
+	for {
+		f := x.freq.Load()
+		if f >= freqMax || x.freq.CompareAndSwap(f, f+1) {
+			return
+		}
+	}
 }
 
-// Cap returns the max cache capacity
-func (s *Sieve[K, V]) Cap() int {
-	return s.capacity
+// handStart returns the node where the hand starts when it isn't set
+// - the tail, unless the cache was created with HandFromHead.
+func (s *Sieve[K, V]) handStart() *Node[K, V] {
+	if s.handHead {
+		return s.head
+	}
+	return s.tail
 }
 
-// String returns a string description of the sieve cache
-func (s *Sieve[K, V]) String() string {
-	s.mu.Lock()
-	m := s.desc()
-	s.mu.Unlock()
-	return m
+// ahead returns the node the hand moves to after 'n'; this is nil at
+// the end of the list.
+func (s *Sieve[K, V]) ahead(n *Node[K, V]) *Node[K, V] {
+	if s.handHead {
+		return n.next
+	}
+	return n.prev
 }
 
-// Dump dumps all the cache contents as a newline delimited
-// string.
-func (s *Sieve[K, V]) Dump() string {
-	var b strings.Builder
+// evictionOrder simulates the eviction walk and returns the first
+// 'want' victims.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) evictionOrder(want int) []K {
+	n := s.size
+	if want > n {
+		want = n
+	}
+	if want <= 0 {
+		return nil
+	}
 
-	s.mu.Lock()
-	b.WriteString(s.desc())
-	b.WriteRune('\n')
-	for n := s.head; n != nil; n = n.next {
-		h := "  "
-		if n == s.hand {
-			h = ">>"
+	s.reap()
+	if s.policy == PolicyFIFO || s.policy == PolicyLRU {
+		out := make([]K, 0, want)
+		for x := s.tail; len(out) < want; x = x.prev {
+			out = append(out, x.key)
 		}
-		b.WriteString(fmt.Sprintf("%svisited=%v, key=%v, val=%v\n", h, n.visited.Load(), n.key, n.val))
+		return out
 	}
-	s.mu.Unlock()
-	return b.String()
-}
 
-// -- internal methods --
+	// index 0 is the head of the list and n-1 is the tail; the
+	// hand moves toward the head - or the tail with HandFromHead.
+	keys := make([]K, 0, n)
+	vis := make([]bool, n)
+	freq := make([]uint32, n)
+	prev := make([]int, n)
+	next := make([]int, n)
 
-// add a new tuple to the cache and evict as necessary
-// caller must hold lock.
-func (s *Sieve[K, V]) add(key K, val V) {
-	// cache miss; we evict and fnd a new node
-	if s.size == s.capacity {
-		s.evict()
+	// the counters that the next sweep would age
+	shift := 0
+	if s.policy == PolicyFrequency && s.freqHits.Load() >= uint64(freqAge*s.capacity) {
+		shift = 1
 	}
 
-	n := s.newNode(key, val)
+	h := -1
+	for x := s.head; x != nil && len(keys) < n; x = x.next {
+		i := len(keys)
+		if x == s.hand {
+			h = i
+		}
+		keys = append(keys, x.key)
+		vis[i] = x.visited.Load()
+		if s.policy == PolicyFrequency {
+			freq[i] = x.ext().freq.Load() >> shift
+		}
+		prev[i] = i - 1
+		next[i] = i + 1
+	}
+	next[n-1] = -1
 
-	// Eviction is guaranteed to remove one node; so this should never happen.
-	if n == nil {
-		msg := fmt.Sprintf("%T: add <%v>: objpool empty after eviction", s, key)
-		panic(msg)
+	head, tail := 0, n-1
+	ahead := func(i int) int {
+		j := prev[i]
+		if s.handHead {
+			j = next[i]
+		}
+		switch {
+		case j >= 0:
+			return j
+		case s.handHead:
+			return head
+		default:
+			return tail
+		}
+	}
+	if h < 0 {
+		h = tail
+		if s.handHead {
+			h = head
+		}
 	}
 
-	s.cache.Put(key, n)
+	out := make([]K, 0, want)
+	cand := make([]int, 0, freqSample)
+	for left := n; len(out) < want; left-- {
+		v := -1
+		if s.policy == PolicyFrequency {
+			cand = cand[:0]
+			for want := min(freqSample, left); len(cand) < want; h = ahead(h) {
+				if vis[h] {
+					vis[h] = false
+				} else if !slices.Contains(cand, h) {
+					cand = append(cand, h)
+					if v < 0 || freq[h] < freq[v] {
+						v = h
+					}
+				}
+			}
+		} else {
+			for ; vis[h]; h = ahead(h) {
+				vis[h] = false
+			}
+			v = h
+		}
+		out = append(out, keys[v])
 
-	// insert at the head of the list
-	n.next = s.head
-	n.prev = nil
-	if s.head != nil {
-		s.head.prev = n
+		// unlink the victim; the hand moves past it
+		p, nx := prev[v], next[v]
+		if p >= 0 {
+			next[p] = nx
+		} else {
+			head = nx
+		}
+		if nx >= 0 {
+			prev[nx] = p
+		} else {
+			tail = p
+		}
+		if left > 1 {
+			h = ahead(v)
+		}
 	}
-	s.head = n
-	if s.tail == nil {
-		s.tail = n
+	return out
+}
+
+// trim evicts entries until the cache is within its weight budget; an
+// entry heavier than the budget is kept as the only entry.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) trim() {
+	if s.maxWeight <= 0 {
+		return
+	}
+	for s.size > 1 && s.stats.bytes.Load() > s.maxWeight {
+		s.evict()
 	}
+}
 
-	s.size += 1
+// Validate checks the internal consistency of the cache: that the
+// size, the map and the list agree and that the list is well formed.
+// It returns a descriptive error for the first violation found; a
+// non-nil error indicates a bug in this package. Validate walks the
+// entire list under the cache lock and is meant for occasional health
+// checks.
+func (s *Sieve[K, V]) Validate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reap()
+	return s.validate()
 }
 
-// evict an item from the cache.
+// validate checks the internal consistency of the cache and returns
+// a descriptive error for the first violation found.
 // NB: Caller must hold the lock
-func (s *Sieve[K, V]) evict() {
-	hand := s.hand
-	if hand == nil {
-		hand = s.tail
+func (s *Sieve[K, V]) validate() error {
+	if s.size < 0 || s.size > s.capacity {
+		return fmt.Errorf("size %d out of bounds (cap %d)", s.size, s.capacity)
+	}
+	if s.head != nil && s.head.prev != nil {
+		return fmt.Errorf("head has a predecessor")
+	}
+	if s.tail != nil && s.tail.next != nil {
+		return fmt.Errorf("tail has a successor")
+	}
+	if (s.head == nil) != (s.tail == nil) {
+		return fmt.Errorf("inconsistent head %p and tail %p", s.head, s.tail)
 	}
 
-	for hand != nil {
-		if !hand.visited.Load() {
-			s.cache.Del(hand.key)
-			s.remove(hand)
-			s.hand = hand.prev
-			return
+	var n int
+	var prev *Node[K, V]
+
+	hand := s.hand == nil
+	for x := s.head; x != nil; x = x.next {
+		if n++; n > s.size {
+			return fmt.Errorf("list longer than size %d", s.size)
 		}
-		hand.visited.Store(false)
-		hand = hand.prev
-		// wrap around and start again
-		if hand == nil {
-			hand = s.tail
+		if x.prev != prev {
+			return fmt.Errorf("key %v: broken prev link", x.key)
 		}
+		if m, ok := s.cache.Get(x.key); !ok || m != x {
+			return fmt.Errorf("key %v: list node not in map", x.key)
+		}
+		if x == s.hand {
+			hand = true
+		}
+		prev = x
 	}
-	s.hand = hand
+
+	if n != s.size {
+		return fmt.Errorf("list length %d != size %d", n, s.size)
+	}
+	if prev != s.tail {
+		return fmt.Errorf("list doesn't end at tail")
+	}
+	if m := s.cache.Len(); m != s.size {
+		return fmt.Errorf("map length %d != size %d", m, s.size)
+	}
+	if !hand {
+		return fmt.Errorf("hand %p not in list", s.hand)
+	}
+	return nil
+}
+
+// unvisited returns up to 'want' unvisited nodes in the order the
+// hand would visit them and the number of visited nodes it passed
+// before reaching the last of them.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) unvisited(want int) ([]*Node[K, V], int) {
+	start := s.hand
+	if start == nil {
+		start = s.handStart()
+	}
+
+	var out []*Node[K, V]
+	var scan, skipped int
+	x := start
+	for i := 0; i < s.size && len(out) < want; i++ {
+		visited := x.visited.Load()
+		if s.trace != nil {
+			s.trace(EvictTrace[K]{Key: x.key, Visited: visited, Evicted: !visited, Scan: skipped})
+		}
+		if visited {
+			skipped++
+		} else {
+			out = append(out, x)
+			scan += skipped
+			skipped = 0
+		}
+		if x = s.ahead(x); x == nil {
+			x = s.handStart()
+		}
+	}
+	return out, scan
+}
+
+// removeExpired removes the expired entries and returns their count
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) removeExpired() int {
+	var n int
+
+	s.reap()
+	for x := s.head; x != nil; {
+		next := x.next
+		if s.expired(x) {
+			s.drop(x, CauseExpired)
+			n++
+		}
+		x = next
+	}
+	return n
+}
+
+// rebuild replaces the internal map with a new one holding just the
+// live entries.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) rebuild() {
+	s.reap()
+	m := s.newMap()
+	for x := s.head; x != nil; x = x.next {
+		m.Put(x.key, x)
+	}
+	s.cache = m
+}
+
+// resize the cache to the new capacity and evict the excess.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) resize(capacity int) {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	s.capacity = capacity
+	for s.size > s.capacity {
+		s.evict()
+	}
+}
+
+// remove a node from the list and return it to the allocator.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) remove(n *Node[K, V]) {
+	s.size -= 1
+	s.gen.Add(1)
+	s.unlink(n)
+	s.free(n)
 }
 
-func (s *Sieve[K, V]) remove(n *node[K, V]) {
+// delete removes a node deleted by the caller: with tombstones, the
+// node is removed from the map and zeroed - but left in the list for
+// reap to unlink.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) delete(n *Node[K, V]) {
+	if !s.tombstones {
+		s.drop(n, CauseDeleted)
+		return
+	}
+
+	s.queue(n, CauseDeleted)
+	s.cache.Del(n.key)
 	s.size -= 1
+	s.gen.Add(1)
+	s.kill(n)
+	s.tombs = append(s.tombs, n)
+}
+
+// reap unlinks the tombstoned nodes from the list and returns them to
+// the allocator.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) reap() {
+	for _, n := range s.tombs {
+		s.unlink(n)
+		n.next, n.prev = nil, nil
+		s.alloc.Free(n)
+	}
+	clear(s.tombs)
+	s.tombs = s.tombs[:0]
+}
+
+// unlink removes a node from the list
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) unlink(n *Node[K, V]) {
+	// don't leave the hand pointing to a freed node
+	if s.hand == n {
+		s.hand = s.ahead(n)
+	}
 
 	// remove node from list
 	if n.prev != nil {
@@ -256,19 +2680,80 @@ func (s *Sieve[K, V]) remove(n *node[K, V]) {
 	} else {
 		s.tail = n.prev
 	}
+}
 
-	s.pool.Put(n)
+// free marks a node removed and returns it to the allocator.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) free(n *Node[K, V]) {
+	s.kill(n)
+	n.next, n.prev = nil, nil
+
+	s.alloc.Free(n)
+}
+
+// kill marks a node removed and drops its weight; lock free readers
+// that still hold it treat it as a miss.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) kill(n *Node[K, V]) {
+	// zero the node so the allocator doesn't pin the key and value
+	var k K
+	var v V
+
+	n.mu.Lock()
+	if s.rindex != nil {
+		s.rindex.del(n.key, n.val)
+	}
+	n.key, n.val = k, v
+	n.clearErr()
+	n.live = false
+
+	// the weight is updated under the node lock by lock free writers
+	if x := n.x.Load(); x != nil && s.sizer != nil {
+		s.stats.bytes.Add(-x.size)
+		x.size = 0
+	}
+	n.mu.Unlock()
 }
 
-func (s *Sieve[K, V]) newNode(key K, val V) *node[K, V] {
-	n := s.pool.Get()
+// newNode returns a live node for a new entry of weight 'sz'; the
+// weight is set under the node lock as a lock free writer holding a
+// stale reference to the reused node may update it.
+// NB: Caller must hold the lock
+func (s *Sieve[K, V]) newNode(key K, val V, sz int64) *Node[K, V] {
+	n := s.alloc.New()
+	n.mu.Lock()
 	n.key, n.val = key, val
+	n.live = true
+
+	// a reused node keeps its metadata; reset it
+	x := n.x.Load()
+	if x == nil && s.needsExt() {
+		x = n.ext()
+	}
+	if x != nil {
+		x.err = nil
+		x.hits.Store(0)
+		x.freq.Store(0)
+		x.expires.Store(0)
+		x.ttl.Store(0)
+		x.size = sz
+		if s.countHits {
+			x.added = s.clock.Now()
+		}
+	}
+	n.mu.Unlock()
 	n.next, n.prev = nil, nil
 	n.visited.Store(false)
 
 	return n
 }
 
+// needsExt returns true if every node needs its metadata - because
+// the cache counts hits, weighs entries or counts accesses.
+func (s *Sieve[K, V]) needsExt() bool {
+	return s.countHits || s.sizer != nil || s.policy == PolicyFrequency
+}
+
 // desc describes the properties of the sieve
 func (s *Sieve[K, V]) desc() string {
 	m := fmt.Sprintf("cache<%T>: size %d, cap %d, head=%p, tail=%p, hand=%p",
@@ -276,6 +2761,25 @@ func (s *Sieve[K, V]) desc() string {
 	return m
 }
 
+// dedup returns 'items' with only the last occurrence of each key
+func dedup[K comparable, V any](items []Entry[K, V]) []Entry[K, V] {
+	last := make(map[K]int, len(items))
+	for i := range items {
+		last[items[i].Key] = i
+	}
+	if len(last) == len(items) {
+		return items
+	}
+
+	out := make([]Entry[K, V], 0, len(last))
+	for i := range items {
+		if last[items[i].Key] == i {
+			out = append(out, items[i])
+		}
+	}
+	return out
+}
+
 // Generic sync.Pool
 type syncPool[T any] struct {
 	pool sync.Pool
@@ -290,12 +2794,12 @@ func newSyncPool[T any]() *syncPool[T] {
 	return p
 }
 
-func (s *syncPool[T]) Get() *T {
+func (s *syncPool[T]) New() *T {
 	p := s.pool.Get()
 	return p.(*T)
 }
 
-func (s *syncPool[T]) Put(n *T) {
+func (s *syncPool[T]) Free(n *T) {
 	s.pool.Put(n)
 }
 
@@ -323,6 +2827,15 @@ func (m *syncMap[K, V]) Put(key K, val V) {
 	m.m.Store(key, val)
 }
 
+func (m *syncMap[K, V]) Len() int {
+	var n int
+	m.m.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
 func (m *syncMap[K, V]) Del(key K) (V, bool) {
 	x, ok := m.m.LoadAndDelete(key)
 	if ok {
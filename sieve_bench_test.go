@@ -15,6 +15,7 @@
 package sieve_test
 
 import (
+	"fmt"
 	"math/rand"
 	"sync/atomic"
 	"testing"
@@ -70,3 +71,407 @@ func BenchmarkSieve_Get(b *testing.B) {
 
 	b.Logf("%d: hit %d, miss %d, ratio %4.2f", b.N, hit, miss, float64(hit)/float64(hit+miss))
 }
+
+type structKey struct {
+	id  uint64
+	sub uint16
+}
+
+func BenchmarkSieve_IntKey(b *testing.B) {
+	c := sieve.New[uint64, int](8192)
+	ent := make([]uint64, b.N)
+	for i := 0; i < b.N; i++ {
+		ent[i] = uint64(rand.Int63() % 16384)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k := ent[i]
+		if _, ok := c.Get(k); !ok {
+			c.Add(k, i)
+		}
+	}
+}
+
+func BenchmarkSieve_StructKey(b *testing.B) {
+	c := sieve.New[structKey, int](8192)
+	ent := make([]structKey, b.N)
+	for i := 0; i < b.N; i++ {
+		v := uint64(rand.Int63() % 16384)
+		ent[i] = structKey{v, uint16(v)}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k := ent[i]
+		if _, ok := c.Get(k); !ok {
+			c.Add(k, i)
+		}
+	}
+}
+
+func BenchmarkSieve_AllHits(b *testing.B) {
+	size := 8192
+	c := sieve.New[int, int](size)
+	for i := 0; i < size; i++ {
+		c.Add(i, i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			if _, ok := c.Get(i % size); !ok {
+				b.Errorf("%d: unexpected miss", i%size)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkSieve_GetBatch(b *testing.B) {
+	c, keys := batchCache(10000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hits, _ := c.GetBatch(keys)
+		if len(hits) == 0 {
+			b.Fatalf("no hits")
+		}
+	}
+}
+
+func BenchmarkSieve_GetEach(b *testing.B) {
+	c, keys := batchCache(10000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var n int
+		c.GetEach(keys, func(k, v int) {
+			n++
+		})
+		if n == 0 {
+			b.Fatalf("no hits")
+		}
+	}
+}
+
+// batchCache returns a cache and a batch of 'n' keys - half of which
+// are in the cache.
+func batchCache(n int) (*sieve.Sieve[int, int], []int) {
+	c := sieve.New[int, int](n)
+	keys := make([]int, n)
+	for i := 0; i < n; i++ {
+		keys[i] = i
+		if i%2 == 0 {
+			c.Add(i, i)
+		}
+	}
+	return c, keys
+}
+
+func BenchmarkSieve_AddBatch1(b *testing.B) {
+	benchEvictBatch(b, 1)
+}
+
+func BenchmarkSieve_AddBatch32(b *testing.B) {
+	benchEvictBatch(b, 32)
+}
+
+// benchEvictBatch measures inserts into a full cache that evicts
+// 'n' entries at a time.
+func benchEvictBatch(b *testing.B, n int) {
+	c := sieve.NewWithOptions[int, int](8192, sieve.WithEvictBatch[int, int](n))
+	for i := 0; i < 8192; i++ {
+		c.Add(i, i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Add(8192+i, i)
+	}
+}
+
+// bigValue is a large value type to expose the cost of copying
+type bigValue struct {
+	buf [4096]byte
+	n   int
+}
+
+func BenchmarkSieve_GetLarge(b *testing.B) {
+	c := bigCache()
+
+	var sum int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		v, _ := c.Get(i & 1023)
+		sum += v.n
+	}
+	_ = sum
+}
+
+func BenchmarkSieve_GetRefLarge(b *testing.B) {
+	c := bigCache()
+
+	var sum int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		v, _ := c.GetRef(i & 1023)
+		sum += v.n
+	}
+	_ = sum
+}
+
+func BenchmarkSieve_GetLargePtr(b *testing.B) {
+	c := bigPtrCache()
+
+	var sum int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		v, _ := c.Get(i & 1023)
+		sum += v.n
+	}
+	_ = sum
+}
+
+// The value is built once outside the loop; so the Add benchmarks
+// measure just the cost of storing it.
+func BenchmarkSieve_AddLarge(b *testing.B) {
+	c := bigCache()
+	v := bigValue{n: 1}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Add(i&2047, v)
+	}
+}
+
+func BenchmarkSieve_AddLargePtr(b *testing.B) {
+	c := bigPtrCache()
+	v := &bigValue{n: 1}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Add(i&2047, v)
+	}
+}
+
+func bigPtrCache() *sieve.Sieve[int, *bigValue] {
+	c := sieve.New[int, *bigValue](1024)
+	for i := 0; i < 1024; i++ {
+		c.Add(i, &bigValue{n: i})
+	}
+	return c
+}
+
+func bigCache() *sieve.Sieve[int, bigValue] {
+	c := sieve.New[int, bigValue](1024)
+	for i := 0; i < 1024; i++ {
+		c.Add(i, bigValue{n: i})
+	}
+	return c
+}
+
+func BenchmarkSieve_ChurnSyncMap(b *testing.B) {
+	benchChurn(b, sieve.New[uint64, uint64](8192))
+}
+
+func BenchmarkSieve_ChurnStriped(b *testing.B) {
+	benchChurn(b, sieve.NewWithOptions[uint64, uint64](8192,
+		sieve.WithStripes[uint64, uint64](64, mix64)))
+}
+
+// benchChurn runs parallel lookups over a key space twice the cache
+// size; half the lookups miss and insert a new entry.
+func benchChurn(b *testing.B, c *sieve.Sieve[uint64, uint64]) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := rand.Uint64()
+		for pb.Next() {
+			k := i % 16384
+			c.Probe(k, k)
+			i++
+		}
+	})
+}
+
+// mix64 is the splitmix64 finalizer
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// BenchmarkSieve_EvictAllVisited measures the worst case eviction: every
+// entry is visited; so the hand clears every flag before it finds a
+// victim.
+func BenchmarkSieve_EvictAllVisited(b *testing.B) {
+	const size = 8192
+
+	c := sieve.New[int, int](size)
+	for i := 0; i < size; i++ {
+		c.Add(i, i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for _, k := range c.Keys() {
+			c.Get(k)
+		}
+		b.StartTimer()
+		c.Add(size+i, i)
+	}
+}
+
+func BenchmarkSieve_StatsInto(b *testing.B) {
+	var st sieve.Stats
+
+	c := sieve.New[int, int](1024)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.StatsInto(&st)
+	}
+}
+
+func BenchmarkSieve_ChurnPrealloc(b *testing.B) {
+	benchChurnAllocs(b, sieve.NewWithOptions[uint64, uint64](8192,
+		sieve.WithStripes[uint64, uint64](64, mix64),
+		sieve.WithPrealloc[uint64, uint64](8192)))
+}
+
+func BenchmarkSieve_ChurnPool(b *testing.B) {
+	benchChurnAllocs(b, sieve.NewWithOptions[uint64, uint64](8192,
+		sieve.WithStripes[uint64, uint64](64, mix64)))
+}
+
+// benchChurnAllocs measures the allocations of adds into a full cache
+// - each evicting an entry - after a warm up.
+func benchChurnAllocs(b *testing.B, c *sieve.Sieve[uint64, uint64]) {
+	for i := uint64(0); i < 2*8192; i++ {
+		c.Add(i, i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k := uint64(i & 16383)
+		c.Add(k, k)
+	}
+}
+
+// byteKeys returns 'n' distinct 16 byte keys
+func byteKeys(n int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key-%012d", i))
+	}
+	return keys
+}
+
+func BenchmarkRawByteCache_Get(b *testing.B) {
+	keys := byteKeys(8192)
+	c := sieve.NewRawByteCache(8192)
+	for _, k := range keys {
+		c.Add(k, k)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Get(keys[i&8191])
+	}
+}
+
+func BenchmarkRawByteCache_GetString(b *testing.B) {
+	keys := byteKeys(8192)
+	c := sieve.New[string, []byte](8192)
+	for _, k := range keys {
+		c.Add(string(k), k)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Get(string(keys[i&8191]))
+	}
+}
+
+func BenchmarkRawByteCache_Add(b *testing.B) {
+	keys := byteKeys(16384)
+	c := sieve.NewRawByteCache(8192)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k := keys[i&16383]
+		c.Add(k, k)
+	}
+}
+
+func BenchmarkRawByteCache_AddString(b *testing.B) {
+	keys := byteKeys(16384)
+	c := sieve.New[string, []byte](8192)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k := keys[i&16383]
+		c.Add(string(k), k)
+	}
+}
+
+func BenchmarkPolicy_SkewedSieve(b *testing.B) {
+	benchSkewed(b, sieve.PolicySieve)
+}
+
+func BenchmarkPolicy_SkewedFrequency(b *testing.B) {
+	benchSkewed(b, sieve.PolicyFrequency)
+}
+
+// benchSkewed measures the hit ratio of a policy on a skewed workload:
+// a hot set of half the cache size is read over and over - and every
+// so often a scan of one-off keys, each read twice in a row, passes
+// through. The second read marks a scanned key visited; so SIEVE can't
+// tell it from a hot key and evicts hot keys. The access counters of
+// PolicyFrequency keep the hot set. A miss adds the key to the cache.
+func benchSkewed(b *testing.B, p sieve.Policy) {
+	const size = 1024
+	const hot = size / 2
+
+	c := sieve.NewWithOptions[uint64, uint64](size, sieve.WithPolicy[uint64, uint64](p))
+	r := rand.New(rand.NewSource(42))
+
+	scan := uint64(1 << 40)
+	keys := make([]uint64, 0, b.N+2*size)
+	for len(keys) < b.N {
+		for i := 0; i < 4*hot; i++ {
+			keys = append(keys, uint64(r.Intn(hot)))
+		}
+		for i := 0; i < size; i++ {
+			keys = append(keys, scan, scan)
+			scan++
+		}
+	}
+
+	b.ResetTimer()
+	for _, k := range keys[:b.N] {
+		if _, ok := c.Get(k); !ok {
+			c.Add(k, k)
+		}
+	}
+	b.StopTimer()
+
+	st := c.Stats()
+	b.ReportMetric(100*float64(st.Hits)/float64(st.Hits+st.Misses), "hit%")
+}
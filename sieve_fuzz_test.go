@@ -0,0 +1,55 @@
+// sieve_fuzz_test.go - fuzz testing the cache operations
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve_test
+
+import (
+	"testing"
+
+	"github.com/opencoff/go-sieve"
+)
+
+// FuzzSieve applies a random sequence of operations to a cache and
+// verifies its internal invariants after every step. Each operation is
+// encoded in two bytes: the opcode and its argument.
+func FuzzSieve(f *testing.F) {
+	f.Add(uint8(4), []byte{0, 1, 0, 2, 0, 3, 0, 4, 0, 5, 1, 1, 3, 2, 4, 0, 0, 6})
+	f.Add(uint8(1), []byte{0, 1, 2, 1, 0, 2, 5, 3, 0, 7, 3, 7})
+	f.Add(uint8(8), []byte{2, 1, 2, 2, 1, 1, 5, 1, 2, 3, 4, 0, 2, 9})
+
+	f.Fuzz(func(t *testing.T, capacity uint8, ops []byte) {
+		s := sieve.New[int, int](int(capacity%32) + 1)
+		for i := 0; i+1 < len(ops); i += 2 {
+			op, arg := ops[i]%6, int(ops[i+1]%64)
+			switch op {
+			case 0:
+				s.Add(arg, arg)
+			case 1:
+				s.Get(arg)
+			case 2:
+				s.Probe(arg, arg)
+			case 3:
+				s.Delete(arg)
+			case 4:
+				s.Purge()
+			case 5:
+				s.Resize(arg%32 + 1)
+			}
+
+			if err := s.Validate(); err != nil {
+				t.Fatalf("op %d <%d, %d>: %s", i/2, op, arg, err)
+			}
+		}
+	})
+}
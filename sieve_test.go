@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"math/rand"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -105,6 +106,1781 @@ func TestAllOps(t *testing.T) {
 	t.Logf("%d items: hit %d, miss %d, ratio %4.2f\n", len(vals), hit, miss, float64(hit)/float64(hit+miss))
 }
 
+func TestTopN(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.NewWithHitCount[int, int](64)
+	for i := 0; i < 32; i++ {
+		s.Add(i, i)
+	}
+
+	// key 'i' for i in [0, 5) is accessed (5-i)*10 times
+	for i := 0; i < 5; i++ {
+		for j := 0; j < (5-i)*10; j++ {
+			_, ok := s.Get(i)
+			assert(ok, "%d: expected to find key", i)
+		}
+	}
+
+	// sprinkle a single access over the rest
+	for i := 5; i < 32; i++ {
+		s.Probe(i, i)
+	}
+
+	top := s.TopN(5)
+	assert(len(top) == 5, "exp 5 top keys, saw %d", len(top))
+	for i := range top {
+		kc := top[i]
+		assert(kc.Key == i, "%d: exp key %d, saw %d", i, i, kc.Key)
+		assert(kc.Hits == uint64((5-i)*10), "%d: exp %d hits, saw %d", i, (5-i)*10, kc.Hits)
+	}
+
+	top = s.TopN(100)
+	assert(len(top) == 32, "exp 32 keys, saw %d", len(top))
+
+	// plain caches don't track hits
+	p := sieve.New[int, int](4)
+	p.Add(1, 1)
+	p.Get(1)
+	assert(p.TopN(1) == nil, "exp nil TopN without hit counting")
+}
+
+func TestDeleteMatching(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[string, int](64)
+	for i := 0; i < 10; i++ {
+		s.Add(fmt.Sprintf("tenant1:%d", i), i)
+		s.Add(fmt.Sprintf("tenant2:%d", i), i)
+	}
+
+	n := s.DeleteMatching(func(k string) bool {
+		return strings.HasPrefix(k, "tenant1:")
+	})
+	assert(n == 10, "exp 10 deletions, saw %d", n)
+	assert(s.Len() == 10, "exp 10 entries, saw %d", s.Len())
+
+	for i := 0; i < 10; i++ {
+		_, ok := s.Get(fmt.Sprintf("tenant1:%d", i))
+		assert(!ok, "%d: tenant1 key not deleted", i)
+
+		v, ok := s.Get(fmt.Sprintf("tenant2:%d", i))
+		assert(ok, "%d: tenant2 key missing", i)
+		assert(v == i, "%d: tenant2 wrong val %d", i, v)
+	}
+
+	n = s.DeleteMatching(func(k string) bool { return false })
+	assert(n == 0, "exp 0 deletions, saw %d", n)
+
+	// the cache must still evict correctly after deletions
+	for i := 0; i < 128; i++ {
+		s.Add(fmt.Sprintf("tenant3:%d", i), i)
+	}
+	assert(s.Len() == 64, "exp full cache, saw %d", s.Len())
+}
+
+func TestReplaceAll(t *testing.T) {
+	assert := newAsserter(t)
+
+	size := 64
+	var purged atomic.Int64
+	s := sieve.NewWithOptions[int, int](size,
+		sieve.WithOnRemove(func(k int, v int, c sieve.Cause) {
+			if c == sieve.CausePurged {
+				purged.Add(1)
+			}
+		}))
+
+	version := func(v int) []sieve.Entry[int, int] {
+		items := make([]sieve.Entry[int, int], size)
+		for i := range items {
+			items[i] = sieve.Entry[int, int]{Key: i + v, Value: v}
+		}
+		return items
+	}
+	s.ReplaceAll(version(0))
+	assert(s.Len() == size, "exp %d entries, saw %d", size, s.Len())
+	assert(purged.Load() == 0, "exp nothing purged, saw %d", purged.Load())
+
+	// readers must see the whole of one version
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				ents, _ := s.Snapshot()
+				assert(len(ents) == size, "partial snapshot: %d entries", len(ents))
+				for _, e := range ents {
+					assert(e.Value == ents[0].Value, "mixed versions: %d vs %d", e.Value, ents[0].Value)
+				}
+			}
+		}()
+	}
+
+	for v := 1; v <= 100; v++ {
+		s.ReplaceAll(version(v))
+	}
+	close(done)
+	wg.Wait()
+
+	assert(purged.Load() == int64(100*size), "exp %d purged, saw %d", 100*size, purged.Load())
+	for i := 0; i < size; i++ {
+		v, ok := s.Get(i + 100)
+		assert(ok && v == 100, "%d: exp latest version, saw %d %v", i, v, ok)
+	}
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
+
+func TestFromMap(t *testing.T) {
+	assert := newAsserter(t)
+
+	m := make(map[int]int)
+	for i := 0; i < 100; i++ {
+		m[i] = i * 10
+	}
+
+	var evicted int
+	s := sieve.FromMap(32, m, sieve.WithOnEvict(func(k, v int) {
+		evicted++
+	}))
+	assert(s.Len() == 32, "exp 32 entries, saw %d", s.Len())
+	assert(evicted == 0, "exp overflow to be dropped - not evicted; saw %d", evicted)
+	for _, k := range s.Keys() {
+		v, ok := s.Get(k)
+		assert(ok && v == m[k], "%d: exp %d, saw %d %v", k, m[k], v, ok)
+	}
+
+	// a small map fits entirely
+	s = sieve.FromMap(32, map[int]int{1: 1, 2: 2})
+	assert(s.Len() == 2 && s.Cap() == 32, "exp 2 entries of cap 32; saw %d %d", s.Len(), s.Cap())
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
+
+func TestMerge(t *testing.T) {
+	assert := newAsserter(t)
+
+	a := sieve.New[int, int](8)
+	b := sieve.New[int, int](8)
+	for i := 0; i < 6; i++ {
+		a.Add(i, i)
+		b.Add(i+3, 100*(i+3))
+	}
+
+	// 3, 4 and 5 are in both
+	var conflicts []int
+	a.Merge(b, func(existing, incoming int) int {
+		conflicts = append(conflicts, existing)
+		return existing + incoming
+	})
+	slices.Sort(conflicts)
+	assert(slices.Equal(conflicts, []int{3, 4, 5}), "exp conflicts on 3,4,5; saw %v", conflicts)
+
+	assert(a.Len() == 8, "exp a full cache, saw %d", a.Len())
+	for i := 3; i < 6; i++ {
+		v, ok := a.Get(i)
+		assert(ok && v == 101*i, "%d: exp %d, saw %d %v", i, 101*i, v, ok)
+	}
+	for i := 6; i < 9; i++ {
+		v, ok := a.Get(i)
+		assert(ok && v == 100*i, "%d: exp %d, saw %d %v", i, 100*i, v, ok)
+	}
+
+	// the merged cache is unchanged
+	assert(b.Len() == 6, "exp 6 entries in b, saw %d", b.Len())
+	v, _ := b.Get(3)
+	assert(v == 300, "exp 300 in b, saw %d", v)
+
+	// without a resolver the incoming value wins
+	c := sieve.New[int, int](2)
+	c.Add(3, 1)
+	c.Merge(b, nil)
+	assert(c.Len() == 2, "exp 2 entries, saw %d", c.Len())
+	assert(c.Validate() == nil, "invariants: %v", c.Validate())
+	for _, k := range c.Keys() {
+		v, _ := c.Get(k)
+		assert(v == 100*k, "%d: exp incoming value, saw %d", k, v)
+	}
+}
+
+func TestPreload(t *testing.T) {
+	assert := newAsserter(t)
+
+	size := 16
+	s := sieve.New[int, int](size)
+
+	items := make([]sieve.Entry[int, int], 0, size*2)
+	for i := 0; i < size*2; i++ {
+		e := sieve.Entry[int, int]{
+			Key:     i,
+			Value:   i * 10,
+			Visited: i%2 == 0,
+		}
+		items = append(items, e)
+	}
+
+	s.Preload(items)
+	assert(s.Len() == size, "exp %d entries, saw %d", size, s.Len())
+
+	// the oldest excess entries must be dropped
+	for i := 0; i < size; i++ {
+		_, ok := s.Get(i)
+		assert(!ok, "%d: exp to be dropped", i)
+	}
+
+	// the visited flags are restored: the next eviction must skip
+	// the oldest entry (16; visited) and evict the next one (17).
+	s.Add(1000, 1000)
+	_, ok := s.Get(size + 1)
+	assert(!ok, "exp %d to be evicted", size+1)
+
+	for i := size + 2; i < size*2; i++ {
+		v, ok := s.Get(i)
+		assert(ok, "%d: exp to be present", i)
+		assert(v == i*10, "%d: wrong val %d", i, v)
+	}
+}
+
+func TestResize(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](32)
+	for i := 0; i < 32; i++ {
+		s.Add(i, i)
+	}
+
+	s.Resize(8)
+	assert(s.Cap() == 8, "exp cap 8, saw %d", s.Cap())
+	assert(s.Len() == 8, "exp len 8, saw %d", s.Len())
+
+	// the oldest entries are evicted first
+	for i := 24; i < 32; i++ {
+		_, ok := s.Get(i)
+		assert(ok, "%d: exp to be present", i)
+	}
+
+	s.Resize(16)
+	for i := 100; i < 108; i++ {
+		s.Add(i, i)
+	}
+	assert(s.Len() == 16, "exp len 16, saw %d", s.Len())
+}
+
+func TestMaxEntries(t *testing.T) {
+	assert := newAsserter(t)
+
+	a := sieve.New[int, int](32)
+	b := sieve.New[int, int](32)
+	assert(a.MaxEntries() == a.Cap(), "exp %d, saw %d", a.Cap(), a.MaxEntries())
+
+	for i := 0; i < 32; i++ {
+		a.Add(i, i)
+		b.Add(i, i)
+	}
+	for i := 0; i < 32; i += 3 {
+		a.Get(i)
+		b.Get(i)
+	}
+
+	// shrink one via the alias and the other via Resize
+	a.SetMaxEntries(8)
+	b.Resize(8)
+	assert(a.MaxEntries() == 8 && a.Cap() == 8, "exp cap 8, saw %d", a.Cap())
+	assert(a.Len() == b.Len(), "exp len %d, saw %d", b.Len(), a.Len())
+	ka, kb := fmt.Sprint(a.Keys()), fmt.Sprint(b.Keys())
+	assert(ka == kb, "exp keys %s, saw %s", kb, ka)
+
+	a.SetMaxEntries(0)
+	b.Resize(0)
+	assert(a.MaxEntries() == b.Cap(), "exp cap %d, saw %d", b.Cap(), a.MaxEntries())
+}
+
+func TestGetBatch(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, string](32)
+	for i := 0; i < 16; i++ {
+		s.Add(i, fmt.Sprintf("%d", i))
+	}
+
+	keys := []int{0, 100, 5, 101, 15, 16}
+	hits, misses := s.GetBatch(keys)
+	assert(len(hits) == 3, "exp 3 hits, saw %d", len(hits))
+	assert(len(misses) == 3, "exp 3 misses, saw %d", len(misses))
+
+	for _, k := range []int{0, 5, 15} {
+		v, ok := hits[k]
+		assert(ok, "%d: exp hit", k)
+		assert(v == fmt.Sprintf("%d", k), "%d: wrong val %s", k, v)
+	}
+
+	exp := []int{100, 101, 16}
+	for i := range exp {
+		assert(misses[i] == exp[i], "%d: exp miss %d, saw %d", i, exp[i], misses[i])
+	}
+
+	st := s.Stats()
+	assert(st.Hits == 3 && st.Misses == 3, "wrong stats %+v", st)
+}
+
+func TestInsertAtTail(t *testing.T) {
+	assert := newAsserter(t)
+
+	ratio := func(mode sieve.InsertMode) float64 {
+		s := sieve.NewWithInsertMode[int, int](100, mode)
+
+		var hit, miss int
+		scan := 1000
+		for r := 0; r < 100; r++ {
+			// working set
+			for i := 0; i < 50; i++ {
+				if _, ok := s.Probe(i, i); ok {
+					hit++
+				} else {
+					miss++
+				}
+			}
+
+			// one-time sequential scan
+			for i := 0; i < 200; i++ {
+				s.Probe(scan, scan)
+				scan++
+			}
+		}
+		assert(s.Len() == 100, "%d: exp full cache, saw %d", mode, s.Len())
+		return float64(hit) / float64(hit+miss)
+	}
+
+	head := ratio(sieve.InsertAtHead)
+	tail := ratio(sieve.InsertAtTail)
+	t.Logf("working set hit ratio: head %4.2f, tail %4.2f\n", head, tail)
+	assert(tail > head, "exp tail insertion to be better: head %4.2f, tail %4.2f", head, tail)
+}
+
+func TestGetEntry(t *testing.T) {
+	assert := newAsserter(t)
+
+	clk := newFakeClock()
+	s := sieve.NewWithOptions[int, string](8,
+		sieve.WithHitCount[int, string](),
+		sieve.WithClock[int, string](clk))
+	s.Add(1, "one")
+	s.Add(2, "two")
+
+	e, ok := s.GetEntry(1)
+	assert(ok, "exp to find 1")
+	assert(e.Key == 1 && e.Value == "one", "wrong entry %+v", e)
+	assert(!e.Visited, "exp 1 to be unvisited before first access")
+	assert(e.Hits == 0, "exp 0 hits, saw %d", e.Hits)
+
+	clk.Advance(2 * time.Millisecond)
+	s.Get(1)
+
+	e, ok = s.GetEntry(1)
+	assert(ok, "exp to find 1")
+	assert(e.Visited, "exp 1 to be visited")
+	assert(e.Hits == 2, "exp 2 hits, saw %d", e.Hits)
+	assert(e.Age == 2*time.Millisecond, "exp age 2ms, saw %s", e.Age)
+
+	// mutating the snapshot mustn't affect the cache
+	e.Value = "uno"
+	v, _ := s.Get(1)
+	assert(v == "one", "snapshot mutation leaked into cache: %s", v)
+
+	_, ok = s.GetEntry(3)
+	assert(!ok, "exp 3 to be absent")
+
+	// plain caches don't track hits or age
+	p := sieve.New[int, string](8)
+	p.Add(1, "one")
+	p.Get(1)
+	e, ok = p.GetEntry(1)
+	assert(ok, "exp to find 1")
+	assert(e.Visited, "exp 1 to be visited")
+	assert(e.Hits == 0 && e.Age == 0, "exp no hits/age: %+v", e)
+}
+
+func TestCompareAndDelete(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, string](8)
+	s.Add(1, "one")
+	s.Add(2, "two")
+
+	old, _ := s.Get(1)
+
+	// a concurrent writer updates the value behind our back
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		s.Add(1, "uno")
+		wg.Done()
+	}()
+	wg.Wait()
+
+	ok := sieve.CompareAndDelete(s, 1, old)
+	assert(!ok, "exp CAD to decline a stale value")
+	v, ok := s.Get(1)
+	assert(ok && v == "uno", "exp 1 to be intact; saw %s", v)
+
+	ok = sieve.CompareAndDelete(s, 1, "uno")
+	assert(ok, "exp CAD to delete matching value")
+	_, ok = s.Get(1)
+	assert(!ok, "exp 1 to be deleted")
+	assert(s.Len() == 1, "exp len 1, saw %d", s.Len())
+
+	ok = sieve.CompareAndDelete(s, 3, "three")
+	assert(!ok, "exp CAD to fail on absent key")
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](8)
+	s.Add(1, 10)
+
+	ok := sieve.CompareAndSwap(s, 1, 10, 11)
+	assert(ok, "exp CAS to succeed")
+	v, _ := s.Get(1)
+	assert(v == 11, "exp 11, saw %d", v)
+
+	ok = sieve.CompareAndSwap(s, 1, 10, 12)
+	assert(!ok, "exp CAS to fail on stale value")
+	v, _ = s.Get(1)
+	assert(v == 11, "exp value unchanged; saw %d", v)
+
+	ok = sieve.CompareAndSwap(s, 2, 0, 1)
+	assert(!ok, "exp CAS to fail on absent key")
+	_, ok = s.Get(2)
+	assert(!ok, "CAS mustn't add absent key")
+}
+
+func TestEvictionOrder(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](5)
+	for i := 1; i <= 5; i++ {
+		s.Add(i, i)
+	}
+	s.Get(1)
+	s.Get(3)
+
+	exp := []int{2, 4, 5, 1, 3}
+	order := s.EvictionOrder()
+	assert(len(order) == len(exp), "exp %d keys, saw %d", len(exp), len(order))
+	for i := range exp {
+		assert(order[i] == exp[i], "%d: exp %d, saw %d", i, exp[i], order[i])
+	}
+
+	// EvictionOrder must not disturb the cache
+	again := s.EvictionOrder()
+	for i := range exp {
+		assert(again[i] == exp[i], "%d: repeat: exp %d, saw %d", i, exp[i], again[i])
+	}
+
+	// and the prediction must match the real evictions; shrinking
+	// the cache evicts without inserting new entries.
+	for i := range exp[:4] {
+		s.Resize(4 - i)
+		_, ok := s.Get(exp[i])
+		assert(!ok, "%d: exp %d to be evicted", i, exp[i])
+	}
+
+	e := sieve.New[int, int](4)
+	assert(len(e.EvictionOrder()) == 0, "exp empty order for empty cache")
+}
+
+func TestRemoveReleasesValue(t *testing.T) {
+	assert := newAsserter(t)
+
+	type blob struct {
+		b [256]byte
+	}
+
+	var freed atomic.Int32
+
+	size := 8
+	s := sieve.New[int, *blob](size)
+	for i := 0; i < size; i++ {
+		b := &blob{}
+		runtime.SetFinalizer(b, func(*blob) { freed.Add(1) })
+		s.Add(i, b)
+	}
+
+	// half are deleted, the other half evicted
+	for i := 0; i < size/2; i++ {
+		s.Delete(i)
+	}
+	s.Resize(1)
+	s.Delete(size - 1)
+	assert(s.Len() == 0, "exp empty cache, saw %d", s.Len())
+
+	// removed nodes may be retained by the node pool across one GC
+	// cycle; they must not pin the values they held.
+	runtime.GC()
+	for i := 0; i < 100 && freed.Load() < int32(size); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert(freed.Load() == int32(size), "exp %d values collected, saw %d", size, freed.Load())
+}
+
+func TestCompute(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[string, int](8)
+
+	// insert
+	v, ok := s.Compute("a", func(old int, exists bool) (int, bool) {
+		assert(!exists, "exp 'a' to be absent")
+		return 1, true
+	})
+	assert(ok && v == 1, "insert: exp 1, saw %d %v", v, ok)
+	v, ok = s.Get("a")
+	assert(ok && v == 1, "insert: exp 'a' == 1, saw %d %v", v, ok)
+
+	// update
+	v, ok = s.Compute("a", func(old int, exists bool) (int, bool) {
+		assert(exists && old == 1, "exp 'a' == 1, saw %d %v", old, exists)
+		return old * 10, true
+	})
+	assert(ok && v == 10, "update: exp 10, saw %d %v", v, ok)
+	v, _ = s.Get("a")
+	assert(v == 10, "update: exp 'a' == 10, saw %d", v)
+
+	// delete
+	_, ok = s.Compute("a", func(old int, exists bool) (int, bool) {
+		return 0, false
+	})
+	assert(!ok, "delete: exp 'a' to be gone")
+	_, ok = s.Get("a")
+	assert(!ok, "delete: exp 'a' to be deleted")
+	assert(s.Len() == 0, "delete: exp empty cache, saw %d", s.Len())
+
+	// declining to insert an absent key is a no-op
+	_, ok = s.Compute("b", func(old int, exists bool) (int, bool) {
+		return 5, false
+	})
+	assert(!ok, "exp 'b' not to be added")
+	assert(s.Len() == 0, "exp empty cache, saw %d", s.Len())
+}
+
+func TestDeleteValue(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, string](8)
+	s.Add(1, "one")
+	s.Add(2, "two")
+
+	v, ok := s.DeleteValue(1)
+	assert(ok, "exp 1 to be deleted")
+	assert(v == "one", "exp 'one', saw %s", v)
+	assert(s.Len() == 1, "exp len 1, saw %d", s.Len())
+
+	v, ok = s.DeleteValue(1)
+	assert(!ok, "exp second delete to fail")
+	assert(v == "", "exp zero value, saw %s", v)
+}
+
+func TestDrain(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](5)
+	for i := 1; i <= 5; i++ {
+		s.Add(i, i*10)
+	}
+	s.Get(1)
+	s.Get(3)
+
+	exp := s.EvictionOrder()
+
+	var keys []int
+	seen := make(map[int]int)
+	s.Drain(func(k, v int) {
+		assert(v == k*10, "%d: wrong val %d", k, v)
+		keys = append(keys, k)
+		seen[k]++
+	})
+
+	assert(s.Len() == 0, "exp empty cache, saw %d", s.Len())
+	assert(len(keys) == len(exp), "exp %d entries, saw %d", len(exp), len(keys))
+	for i := range exp {
+		assert(keys[i] == exp[i], "%d: exp %d, saw %d", i, exp[i], keys[i])
+	}
+	for k, n := range seen {
+		assert(n == 1, "%d: drained %d times", k, n)
+	}
+
+	// the cache is usable after a drain
+	s.Add(100, 100)
+	v, ok := s.Get(100)
+	assert(ok && v == 100, "exp 100 after drain")
+}
+
+func TestTinyCache(t *testing.T) {
+	assert := newAsserter(t)
+
+	// capacity 1: every new key evicts the previous one
+	s := sieve.New[int, int](1)
+	for i := 0; i < 8; i++ {
+		ok := s.Add(i, i)
+		assert(!ok, "cap 1: %d: exp new add", i)
+		assert(s.Len() == 1, "cap 1: %d: exp len 1, saw %d", i, s.Len())
+
+		// make the sole entry visited; it must still be evicted
+		v, ok := s.Get(i)
+		assert(ok && v == i, "cap 1: %d: exp to find key", i)
+		if i > 0 {
+			_, ok = s.Get(i - 1)
+			assert(!ok, "cap 1: %d: exp %d to be evicted", i, i-1)
+		}
+	}
+
+	v, ok := s.Probe(100, 100)
+	assert(!ok && v == 100, "cap 1: exp probe to add")
+	_, ok = s.Get(7)
+	assert(!ok, "cap 1: exp 7 to be evicted by probe")
+	v, ok = s.Probe(100, 0)
+	assert(ok && v == 100, "cap 1: exp probe hit")
+
+	// capacity 2: the unvisited entry is evicted first
+	s = sieve.New[int, int](2)
+	s.Add(1, 1)
+	s.Add(2, 2)
+	s.Get(1)
+	s.Add(3, 3)
+	_, ok = s.Get(2)
+	assert(!ok, "cap 2: exp 2 to be evicted")
+	_, ok = s.Get(1)
+	assert(ok, "cap 2: exp 1 to be present")
+
+	// both visited: the hand clears both and evicts the oldest
+	s.Get(3)
+	s.Probe(4, 4)
+	assert(s.Len() == 2, "cap 2: exp len 2, saw %d", s.Len())
+	_, ok = s.Get(4)
+	assert(ok, "cap 2: exp 4 to be present")
+
+	// non-positive capacity is clamped
+	s = sieve.New[int, int](0)
+	assert(s.Cap() == 1, "exp cap 1, saw %d", s.Cap())
+	s.Add(1, 1)
+	s.Add(2, 2)
+	assert(s.Len() == 1, "cap 0: exp len 1, saw %d", s.Len())
+}
+
+func TestGetEach(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](32)
+	for i := 0; i < 16; i++ {
+		s.Add(i, i*2)
+	}
+
+	seen := make(map[int]int)
+	s.GetEach([]int{0, 100, 5, 15, 16}, func(k, v int) {
+		seen[k] = v
+	})
+
+	assert(len(seen) == 3, "exp 3 hits, saw %d", len(seen))
+	for _, k := range []int{0, 5, 15} {
+		assert(seen[k] == k*2, "%d: wrong val %d", k, seen[k])
+	}
+
+	st := s.Stats()
+	assert(st.Hits == 3 && st.Misses == 2, "wrong stats %+v", st)
+}
+
+func TestCacheInterface(t *testing.T) {
+	assert := newAsserter(t)
+
+	var c sieve.Cache[string, int] = sieve.New[string, int](2)
+
+	ok := c.Add("a", 1)
+	assert(!ok, "exp new add")
+	ok = c.Add("a", 2)
+	assert(ok, "exp replace")
+
+	v, ok := c.Get("a")
+	assert(ok && v == 2, "exp 'a' == 2, saw %d %v", v, ok)
+
+	c.Add("b", 3)
+	assert(c.Len() == 2, "exp len 2, saw %d", c.Len())
+
+	ok = c.Remove("a")
+	assert(ok, "exp remove of 'a'")
+	ok = c.Remove("a")
+	assert(!ok, "exp second remove to fail")
+
+	c.Purge()
+	assert(c.Len() == 0, "exp empty cache, saw %d", c.Len())
+}
+
+func TestIterate(t *testing.T) {
+	assert := newAsserter(t)
+
+	size := 100
+	s := sieve.New[int, int](size)
+	for i := 0; i < size; i++ {
+		s.Add(i, i)
+	}
+
+	var c sieve.Cursor[int]
+	var pages int
+
+	seen := make(map[int]bool)
+	for done := false; !done; {
+		var ents []sieve.Entry[int, int]
+
+		ents, c, done = s.Iterate(c, 7)
+		assert(len(ents) <= 7, "page %d too big: %d", pages, len(ents))
+		for _, e := range ents {
+			assert(e.Key == e.Value, "wrong entry %+v", e)
+			assert(!seen[e.Key], "%d: seen twice", e.Key)
+			seen[e.Key] = true
+		}
+
+		// concurrent mutations between pages
+		if pages == 2 {
+			s.Delete(99)
+			s.Delete(0)
+			s.Add(1000, 1000)
+		}
+		pages++
+	}
+
+	assert(pages == 15, "exp 15 pages, saw %d", pages)
+	assert(len(seen) == size-1, "exp %d entries, saw %d", size-1, len(seen))
+	assert(!seen[1000], "exp new key not to be visited")
+
+	// iteration doesn't boost entries
+	ents, _, _ := s.Iterate(sieve.Cursor[int]{}, size)
+	for _, e := range ents {
+		assert(!e.Visited, "%d: exp unvisited", e.Key)
+	}
+}
+
+func TestDeleteMulti(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](8)
+	for i := 0; i < 8; i++ {
+		s.Add(i, i)
+	}
+
+	// visit 1 and evict 0; the hand now points at 1
+	s.Get(1)
+	s.Add(8, 8)
+	_, ok := s.Get(0)
+	assert(!ok, "exp 0 to be evicted")
+
+	n := s.DeleteMulti([]int{1, 3, 5, 100, 3})
+	assert(n == 3, "exp 3 deletions, saw %d", n)
+	assert(s.Len() == 5, "exp len 5, saw %d", s.Len())
+	err := s.Validate()
+	assert(err == nil, "invariants: %v", err)
+
+	for _, k := range []int{2, 4, 6, 7, 8} {
+		_, ok := s.Get(k)
+		assert(ok, "%d: exp to be present", k)
+	}
+
+	// and the cache continues to evict correctly
+	for i := 10; i < 20; i++ {
+		s.Add(i, i)
+		err := s.Validate()
+		assert(err == nil, "%d: invariants: %v", i, err)
+	}
+	assert(s.Len() == 8, "exp len 8, saw %d", s.Len())
+}
+
+func TestAddMany(t *testing.T) {
+	assert := newAsserter(t)
+
+	size := 8
+	s := sieve.New[int, int](size)
+	for i := 0; i < size; i++ {
+		s.Add(i, i)
+	}
+	for i := 0; i < size; i += 2 {
+		s.Get(i)
+	}
+
+	// the next 'size' victims per SIEVE order
+	exp := s.EvictionOrder()[:size/2]
+
+	items := make([]sieve.Entry[int, int], 0, size*2)
+	for i := 100; i < 100+size*2; i++ {
+		items = append(items, sieve.Entry[int, int]{Key: i, Value: i})
+	}
+
+	ev := s.AddMany(items)
+	assert(len(ev) == size*2, "exp %d evictions, saw %d", size*2, len(ev))
+	assert(s.Len() == size, "exp len %d, saw %d", size, s.Len())
+
+	// the unvisited originals go first
+	for i := range exp {
+		assert(ev[i].Key == exp[i], "%d: exp victim %d, saw %d", i, exp[i], ev[i].Key)
+		assert(ev[i].Value == exp[i], "%d: wrong value %d", i, ev[i].Value)
+	}
+
+	// and the reported victims are really gone
+	for i := range ev {
+		_, ok := s.Get(ev[i].Key)
+		assert(!ok, "%d: exp %d to be evicted", i, ev[i].Key)
+	}
+
+	live := s.EvictionOrder()
+	items = items[:0]
+	for _, k := range live {
+		items = append(items, sieve.Entry[int, int]{Key: k, Value: k})
+	}
+	ev = s.AddMany(items)
+	assert(len(ev) == 0, "exp no evictions for replacements, saw %d", len(ev))
+}
+
+func TestBatchDuplicates(t *testing.T) {
+	assert := newAsserter(t)
+
+	items := []sieve.Entry[int, string]{
+		{Key: 1, Value: "a"},
+		{Key: 2, Value: "b"},
+		{Key: 1, Value: "c", Visited: true},
+		{Key: 3, Value: "d"},
+		{Key: 2, Value: "e"},
+		{Key: 1, Value: "f"},
+	}
+
+	// AddMany
+	s := sieve.New[int, string](4)
+	ev := s.AddMany(items)
+	assert(len(ev) == 0, "exp no evictions, saw %d", len(ev))
+	assert(s.Len() == 3, "exp 3 entries, saw %d", s.Len())
+	err := s.Validate()
+	assert(err == nil, "invariants: %v", err)
+
+	exp := map[int]string{1: "f", 2: "e", 3: "d"}
+	for k, x := range exp {
+		v, ok := s.Get(k)
+		assert(ok && v == x, "%d: exp %s, saw %s", k, x, v)
+	}
+
+	// Preload: duplicates don't count against capacity
+	s = sieve.New[int, string](3)
+	s.Preload(items)
+	assert(s.Len() == 3, "exp 3 entries, saw %d", s.Len())
+	err = s.Validate()
+	assert(err == nil, "invariants: %v", err)
+
+	// the last occurrence determines the position: 3 is the oldest
+	order := s.EvictionOrder()
+	assert(order[0] == 3, "exp 3 to be oldest, saw %v", order)
+	for k, x := range exp {
+		v, ok := s.Get(k)
+		assert(ok && v == x, "preload: %d: exp %s, saw %s", k, x, v)
+	}
+}
+
+func TestShrinkToFit(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](1000)
+	for i := 0; i < 1000; i++ {
+		s.Add(i, i)
+	}
+	for i := 0; i < 990; i++ {
+		s.Delete(i)
+	}
+
+	s.ShrinkToFit()
+	assert(s.Cap() == 10, "exp cap 10, saw %d", s.Cap())
+	assert(s.Len() == 10, "exp len 10, saw %d", s.Len())
+	err := s.Validate()
+	assert(err == nil, "invariants: %v", err)
+
+	for i := 990; i < 1000; i++ {
+		v, ok := s.Get(i)
+		assert(ok && v == i, "%d: exp to be present", i)
+	}
+
+	// growth beyond the new capacity evicts
+	s.Add(2000, 2000)
+	assert(s.Len() == 10, "exp len 10, saw %d", s.Len())
+
+	s.Purge()
+	s.ShrinkToFit()
+	assert(s.Cap() == 1, "exp cap 1 for empty cache, saw %d", s.Cap())
+}
+
+func TestRekey(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[string, int](4)
+	s.Add("a", 1)
+	s.Add("tmp-b", 2)
+	s.Add("c", 3)
+	s.Get("tmp-b")
+
+	before := s.EvictionOrder()
+
+	ok := s.Rekey("tmp-b", "b")
+	assert(ok, "exp rekey to succeed")
+	err := s.Validate()
+	assert(err == nil, "invariants: %v", err)
+
+	_, ok = s.Get("tmp-b")
+	assert(!ok, "exp old key to be gone")
+
+	// same position in the eviction order
+	after := s.EvictionOrder()
+	for i := range before {
+		exp := before[i]
+		if exp == "tmp-b" {
+			exp = "b"
+		}
+		assert(after[i] == exp, "%d: exp %s, saw %s", i, exp, after[i])
+	}
+
+	// and the visited state is retained
+	ents, _, _ := s.Iterate(sieve.Cursor[string]{}, 4)
+	for _, e := range ents {
+		assert(e.Visited == (e.Key == "b"), "%s: wrong visited %v", e.Key, e.Visited)
+	}
+
+	v, ok := s.Get("b")
+	assert(ok && v == 2, "exp b == 2, saw %d %v", v, ok)
+
+	ok = s.Rekey("a", "c")
+	assert(!ok, "exp rekey to an existing key to fail")
+	ok = s.Rekey("x", "y")
+	assert(!ok, "exp rekey of an absent key to fail")
+}
+
+func TestGetRef(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, [4]int](4)
+	s.Add(1, [4]int{1, 2, 3, 4})
+
+	p, ok := s.GetRef(1)
+	assert(ok, "GetRef: key 1 missing")
+	assert(p[2] == 3, "GetRef: exp 3, saw %d", p[2])
+
+	// writes through the pointer are visible to later lookups
+	p[2] = 30
+	v, ok := s.Get(1)
+	assert(ok, "Get: key 1 missing")
+	assert(v[2] == 30, "Get: exp 30, saw %d", v[2])
+
+	p, ok = s.GetRef(2)
+	assert(!ok && p == nil, "GetRef: exp miss for key 2")
+	assert(s.Stats().Misses == 1, "exp 1 miss, saw %d", s.Stats().Misses)
+}
+
+func TestAddIfChanged(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, string](2)
+	assert(sieve.AddIfChanged(s, 1, "a"), "exp add of new key")
+	assert(sieve.AddIfChanged(s, 2, "b"), "exp add of new key")
+
+	// an identical value leaves the entry unvisited
+	assert(!sieve.AddIfChanged(s, 1, "a"), "exp no change for identical value")
+	assert(!s.Inspect().Visited[1], "unchanged entry marked visited")
+
+	// so it is the first eviction candidate
+	s.Add(3, "c")
+	_, ok := s.Inspect().Visited[1]
+	assert(!ok, "exp 1 to be evicted")
+
+	// a different value updates and marks the entry visited
+	assert(sieve.AddIfChanged(s, 2, "B"), "exp change for different value")
+	assert(s.Inspect().Visited[2], "changed entry not marked visited")
+	v, _ := s.Get(2)
+	assert(v == "B", "exp B, saw %s", v)
+}
+
+func TestPointerValuesReleased(t *testing.T) {
+	assert := newAsserter(t)
+
+	type big struct {
+		buf [4096]byte
+	}
+
+	var freed atomic.Int32
+	track := func() *big {
+		v := &big{}
+		runtime.SetFinalizer(v, func(*big) { freed.Add(1) })
+		return v
+	}
+	collect := func(want int32) {
+		for end := time.Now().Add(2 * time.Second); freed.Load() < want && time.Now().Before(end); {
+			runtime.GC()
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// unlike TestRemoveReleasesValue, cover the paths that drop values
+	// without a delete: adds that evict, replacing a value and Purge
+	s := sieve.New[int, *big](4)
+	for i := 0; i < 8; i++ {
+		s.Add(i, track())
+	}
+	s.Add(7, track())
+
+	// the 4 evicted values and the replaced one must be collectable
+	collect(5)
+	assert(freed.Load() == 5, "exp 5 values freed, saw %d", freed.Load())
+	assert(s.Len() == 4, "exp 4 entries, saw %d", s.Len())
+
+	s.Purge()
+	collect(9)
+	assert(freed.Load() == 9, "exp 9 values freed after purge, saw %d", freed.Load())
+}
+
+func TestGetAndCool(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](4)
+	for i := 0; i < 4; i++ {
+		s.Add(i, i)
+		s.Get(i)
+	}
+	assert(s.VisitedCount() == 4, "exp all visited, saw %d", s.VisitedCount())
+
+	v, ok := s.GetAndCool(2)
+	assert(ok && v == 2, "exp 2, saw %d %v", v, ok)
+	e, _ := s.GetEntry(1)
+	assert(e.Visited, "exp 1 to stay visited")
+	_, was, _ := s.GetVisited(2)
+	assert(!was, "exp 2 to be cool")
+	s.GetAndCool(2)
+
+	// 2 is the only unvisited entry; so it's evicted first
+	s.Add(4, 4)
+	_, ok = s.Get(2)
+	assert(!ok, "exp 2 to be evicted")
+	k, _ := s.LastEvicted()
+	assert(k == 2, "exp 2 evicted, saw %d", k)
+
+	_, ok = s.GetAndCool(100)
+	assert(!ok, "exp miss")
+	st := s.Stats()
+	assert(st.Hits == 8 && st.Misses == 2, "exp 8 hits 2 misses, saw %d %d", st.Hits, st.Misses)
+}
+
+func TestVisitedCount(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](8)
+	assert(s.VisitedCount() == 0, "exp 0 for an empty cache")
+	for i := 0; i < 8; i++ {
+		s.Add(i, i)
+	}
+	assert(s.VisitedCount() == 0, "exp 0 after inserts, saw %d", s.VisitedCount())
+
+	for i := 0; i < 8; i += 2 {
+		s.Get(i)
+	}
+	s.Get(0)
+	assert(s.VisitedCount() == 4, "exp 4 visited, saw %d", s.VisitedCount())
+
+	// the eviction clears the flag of 0 and evicts 1
+	s.Add(8, 8)
+	assert(s.VisitedCount() == 3, "exp 3 visited, saw %d", s.VisitedCount())
+}
+
+func TestIsHand(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](4)
+	for i := 0; i < 4; i++ {
+		s.Add(i, i)
+	}
+	for i := 0; i < 4; i++ {
+		assert(!s.IsHand(i), "%d: exp hand to be unset", i)
+	}
+
+	// 0 is visited and skipped; 1 is evicted and the hand stops at 2
+	s.Get(0)
+	s.Add(4, 4)
+	assert(s.IsHand(2), "exp hand at 2")
+	for _, k := range []int{0, 1, 3, 4} {
+		assert(!s.IsHand(k), "%d: exp hand elsewhere", k)
+	}
+
+	// evicting the head wraps the hand
+	s.Get(2)
+	s.Get(3)
+	s.Add(5, 5)
+	_, ok := s.Get(4)
+	assert(!ok, "exp 4 to be evicted")
+	assert(!s.IsHand(5), "exp hand to be unset after the head")
+	for i := 0; i < 6; i++ {
+		assert(!s.IsHand(i), "%d: exp hand to be unset", i)
+	}
+}
+
+func TestLastEvicted(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](4)
+	for i := 0; i < 4; i++ {
+		s.Add(i, i)
+	}
+	_, ok := s.LastEvicted()
+	assert(!ok, "exp no eviction yet")
+
+	s.Delete(3)
+	_, ok = s.LastEvicted()
+	assert(!ok, "exp delete to not count")
+
+	s.Add(3, 3)
+	s.Get(0)
+	s.Add(4, 4)
+	k, ok := s.LastEvicted()
+	assert(ok && k == 1, "exp 1 evicted, saw %d %v", k, ok)
+
+	s.Add(5, 5)
+	k, ok = s.LastEvicted()
+	assert(ok && k == 2, "exp 2 evicted, saw %d %v", k, ok)
+}
+
+func TestDumpCycle(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](8)
+	for i := 0; i < 4; i++ {
+		s.Add(i, i)
+	}
+	sieve.MakeCycle(s)
+
+	done := make(chan string)
+	go func() {
+		d := s.Dump()
+		s.Keys()
+		s.Snapshot()
+		s.Inspect()
+		sieve.Sum(s)
+		done <- d
+	}()
+
+	select {
+	case d := <-done:
+		assert(strings.Contains(d, "corrupt"), "exp corruption warning, saw\n%s", d)
+		assert(strings.Count(d, "key=") == 4, "exp 4 entries, saw\n%s", d)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("traversal of a cyclic list didn't terminate")
+	}
+	assert(len(s.Keys()) == 4, "exp 4 keys, saw %v", s.Keys())
+	assert(s.Validate() != nil, "exp Validate to flag the cycle")
+}
+
+func TestKeysChan(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](16)
+	for i := 0; i < 24; i++ {
+		s.Add(i, i)
+	}
+
+	keys := s.Keys()
+	assert(len(keys) == 16 && keys[0] == 23, "exp 16 keys, newest first; saw %v", keys)
+
+	var got []int
+	for k := range s.KeysChan() {
+		// the lock isn't held while we consume
+		s.Add(k+100, k)
+		got = append(got, k)
+	}
+	assert(slices.Equal(got, keys), "exp %v, saw %v", keys, got)
+
+	e := sieve.New[int, int](4)
+	for range e.KeysChan() {
+		t.Fatalf("exp no keys from an empty cache")
+	}
+}
+
+func TestSnapshotGeneration(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](4)
+	g0 := s.Generation()
+	for i := 0; i < 3; i++ {
+		s.Add(i, i)
+	}
+
+	ents, g1 := s.Snapshot()
+	assert(g1 > g0, "generation didn't advance on add: %d, %d", g0, g1)
+	assert(len(ents) == 3, "exp 3 entries, saw %d", len(ents))
+	for i, e := range ents {
+		k := 2 - i
+		assert(e.Key == k && e.Value == k, "%d: exp %d, saw %+v", i, k, e)
+	}
+
+	// lookups don't change the cache contents
+	s.Get(1)
+	s.Get(10)
+	assert(s.Generation() == g1, "generation advanced on lookup")
+
+	s.Add(1, 100)
+	g2 := s.Generation()
+	assert(g2 > g1, "generation didn't advance on update: %d, %d", g1, g2)
+
+	s.Delete(2)
+	g3 := s.Generation()
+	assert(g3 > g2, "generation didn't advance on delete: %d, %d", g2, g3)
+
+	s.Purge()
+	assert(s.Generation() > g3, "generation didn't advance on purge")
+}
+
+func TestPolicies(t *testing.T) {
+	assert := newAsserter(t)
+
+	// the same access sequence on each policy: fill the cache, hit
+	// the oldest entry, then add two more.
+	run := func(p sieve.Policy) []int {
+		s := sieve.NewWithOptions[int, int](3, sieve.WithPolicy[int, int](p))
+		s.Add(1, 1)
+		s.Add(2, 2)
+		s.Add(3, 3)
+		s.Get(1)
+		s.Add(4, 4)
+		s.Add(5, 5)
+
+		var keys []int
+		ents, _ := s.Snapshot()
+		for _, e := range ents {
+			keys = append(keys, e.Key)
+		}
+		assert(s.Validate() == nil, "%v: %v", p, s.Validate())
+		return keys
+	}
+
+	// SIEVE keeps 1 in place and evicts 2, then 3
+	keys := run(sieve.PolicySieve)
+	assert(fmt.Sprint(keys) == "[5 4 1]", "sieve: saw %v", keys)
+
+	// FIFO evicts 1 and 2 despite the hit
+	keys = run(sieve.PolicyFIFO)
+	assert(fmt.Sprint(keys) == "[5 4 3]", "fifo: saw %v", keys)
+
+	// LRU moves 1 to the head and evicts 2, then 3
+	keys = run(sieve.PolicyLRU)
+	assert(fmt.Sprint(keys) == "[5 4 1]", "lru: saw %v", keys)
+
+	// frequency spares 1 like SIEVE - and then prefers 3 over 1
+	keys = run(sieve.PolicyFrequency)
+	assert(fmt.Sprint(keys) == "[5 4 1]", "frequency: saw %v", keys)
+}
+
+func TestPolicyFrequency(t *testing.T) {
+	assert := newAsserter(t)
+
+	// 1 is hit often; once the hand clears its flag, it is unvisited
+	// while the newer entries are visited. SIEVE evicts 1 on the next
+	// lap - the frequency policy evicts a less popular entry.
+	run := func(p sieve.Policy) *sieve.Sieve[int, int] {
+		s := sieve.NewWithOptions[int, int](4, sieve.WithPolicy[int, int](p))
+		for i := 1; i <= 4; i++ {
+			s.Add(i, i)
+		}
+		for i := 0; i < 10; i++ {
+			s.Get(1)
+		}
+		s.Add(5, 5)
+		s.Get(3)
+		s.Get(4)
+		s.Get(5)
+		s.Add(6, 6)
+		assert(s.Validate() == nil, "%v: %v", p, s.Validate())
+		return s
+	}
+
+	s := run(sieve.PolicySieve)
+	keys := fmt.Sprint(s.Keys())
+	assert(keys == "[6 5 4 3]", "sieve: saw %s", keys)
+
+	s = run(sieve.PolicyFrequency)
+	keys = fmt.Sprint(s.Keys())
+	assert(keys == "[6 5 4 1]", "frequency: saw %s", keys)
+
+	// the predicted eviction order matches the real one
+	s.Get(6)
+	exp := s.EvictionOrder()
+	var saw []int
+	s.Drain(func(k, _ int) {
+		saw = append(saw, k)
+	})
+	assert(fmt.Sprint(saw) == fmt.Sprint(exp), "exp order %v, saw %v", exp, saw)
+}
+
+func TestPolicyLRUOrder(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.NewWithOptions[int, int](3, sieve.WithPolicy[int, int](sieve.PolicyLRU))
+	s.Add(1, 1)
+	s.Add(2, 2)
+	s.Add(3, 3)
+
+	// 2 is now the most recent; 1 is the least
+	s.Get(2)
+	st := s.Inspect()
+	assert(st.Head == 2 && st.Tail == 1, "exp head 2, tail 1; saw %d, %d", st.Head, st.Tail)
+
+	// unlike SIEVE, hitting 1 and 3 leaves 2 as the LRU victim
+	s.Get(1)
+	s.Get(3)
+	order := s.EvictionOrder()
+	assert(fmt.Sprint(order) == "[2 1 3]", "exp [2 1 3], saw %v", order)
+
+	s.Add(4, 4)
+	_, ok := s.Inspect().Visited[2]
+	assert(!ok, "exp 2 to be evicted")
+}
+
+func TestAddVisited(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](3)
+	assert(!s.AddVisited(1, 1, true), "1: exp insert")
+	assert(!s.AddVisited(2, 2, false), "2: exp insert")
+	assert(!s.AddVisited(3, 3, true), "3: exp insert")
+
+	st := s.Inspect()
+	assert(st.Visited[1] && !st.Visited[2] && st.Visited[3], "visited: %v", st.Visited)
+
+	// replacing an entry takes the supplied flag - not Add's true
+	s.Get(3)
+	assert(s.AddVisited(3, 30, false), "3: exp replace")
+	assert(!s.Inspect().Visited[3], "3: exp unvisited")
+
+	// 1 is visited; so 2 is the next victim
+	order := s.EvictionOrder()
+	assert(order[0] == 2, "exp 2 as the next victim, saw %v", order)
+
+	s.Add(4, 4)
+	_, ok := s.Inspect().Visited[2]
+	assert(!ok, "exp 2 to be evicted")
+}
+
+func TestCompact(t *testing.T) {
+	assert := newAsserter(t)
+
+	size := 4096
+	clk := newFakeClock()
+	s := sieve.NewWithOptions[int, int](size, sieve.WithClock[int, int](clk))
+	for i := 0; i < size; i++ {
+		s.Add(i, i)
+	}
+	for i := 0; i < size; i++ {
+		if i%512 != 0 {
+			s.Delete(i)
+		} else if i%1024 == 0 {
+			s.Get(i)
+		}
+	}
+	s.AddWithTTL(-1, -1, time.Second)
+	clk.Advance(2 * time.Second)
+
+	before, _ := s.Snapshot()
+	order := slices.DeleteFunc(s.EvictionOrder(), func(k int) bool {
+		return k == -1
+	})
+
+	s.Compact()
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+	assert(s.Len() == 8, "exp 8 entries, saw %d", s.Len())
+	assert(s.Cap() == size, "exp cap %d, saw %d", size, s.Cap())
+
+	after, _ := s.Snapshot()
+	assert(fmt.Sprint(before) == fmt.Sprint(after), "entries changed:\n%v\n%v", before, after)
+	assert(fmt.Sprint(order) == fmt.Sprint(s.EvictionOrder()), "eviction order changed")
+
+	// the new map works as before
+	for i := 0; i < size; i += 512 {
+		v, ok := s.Get(i)
+		assert(ok && v == i, "%d: exp to find it, saw %d %v", i, v, ok)
+	}
+	_, ok := s.Get(-1)
+	assert(!ok, "exp expired entry to be gone")
+
+	s.Add(size, size)
+	assert(s.Len() == 9, "exp 9 entries, saw %d", s.Len())
+}
+
+func TestString(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, string](8)
+	for i := 0; i < 5; i++ {
+		s.Add(i, "x")
+	}
+	s.Get(1)
+	s.Get(2)
+	s.Get(10)
+
+	exp := "Sieve[int,string]{size=5 cap=8 hits=2 misses=1}"
+	str := fmt.Sprintf("%v", s)
+	assert(str == exp, "exp %q, saw %q", exp, str)
+}
+
+func TestValidate(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](4)
+	assert(s.Validate() == nil, "empty: %v", s.Validate())
+
+	for i := 0; i < 10; i++ {
+		s.Add(i, i)
+		s.Get(i / 2)
+	}
+	s.Delete(9)
+	assert(s.Validate() == nil, "valid: %v", s.Validate())
+
+	sieve.SkewSize(s, 1)
+	err := s.Validate()
+	assert(err != nil && strings.Contains(err.Error(), "list length"), "exp list length error, saw %v", err)
+
+	sieve.SkewSize(s, -2)
+	err = s.Validate()
+	assert(err != nil && strings.Contains(err.Error(), "list longer"), "exp list longer error, saw %v", err)
+
+	sieve.SkewSize(s, 1)
+	assert(s.Validate() == nil, "restored: %v", s.Validate())
+}
+
+func TestGetOrAddFunc(t *testing.T) {
+	assert := newAsserter(t)
+
+	var calls [8]atomic.Int32
+	var added atomic.Int32
+	factory := func(k int) int {
+		calls[k].Add(1)
+		return k * 10
+	}
+
+	s := sieve.New[int, int](16)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < len(calls); k++ {
+				v, isNew := s.GetOrAddFunc(k, factory)
+				assert(v == k*10, "%d: exp %d, saw %d", k, k*10, v)
+				if isNew {
+					added.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for k := range calls {
+		assert(calls[k].Load() == 1, "%d: exp 1 factory call, saw %d", k, calls[k].Load())
+	}
+	assert(added.Load() == int32(len(calls)), "exp %d adds, saw %d", len(calls), added.Load())
+	assert(s.Len() == len(calls), "exp %d entries, saw %d", len(calls), s.Len())
+}
+
+func TestConcurrentRemoveGet(t *testing.T) {
+	assert := newAsserter(t)
+
+	// lookups racing with deletes and evictions must never see the
+	// zeroed or recycled node of another key.
+	size := 64
+	s := sieve.New[int, int](size)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for j := 0; j < 20000; j++ {
+				k := 1 + r.Intn(size*2)
+				switch j % 3 {
+				case 0:
+					s.Add(k, k)
+				case 1:
+					s.Delete(k)
+				default:
+					if v, ok := s.Get(k); ok {
+						assert(v == k, "get %d: wrong value %d", k, v)
+					}
+					if e, ok := s.GetEntry(k); ok {
+						assert(e.Key == k && e.Value == k, "entry %d: wrong entry %+v", k, e)
+					}
+					if v, ok := s.Probe(k, k); ok {
+						assert(v == k, "probe %d: wrong value %d", k, v)
+					}
+				}
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
+
+func TestEvictN(t *testing.T) {
+	assert := newAsserter(t)
+
+	var evicted []int
+	size := 16
+	s := sieve.NewWithOptions[int, int](size, sieve.WithOnEvict(func(k, _ int) {
+		evicted = append(evicted, k)
+	}))
+	for i := 0; i < size; i++ {
+		s.Add(i, i)
+		if i%3 == 0 {
+			s.Get(i)
+		}
+	}
+
+	order := s.EvictionOrder()
+	n := s.EvictN(5)
+	assert(n == 5, "exp 5 evictions, saw %d", n)
+	assert(s.Len() == size-5, "exp len %d, saw %d", size-5, s.Len())
+	assert(fmt.Sprint(evicted) == fmt.Sprint(order[:5]), "exp victims %v, saw %v", order[:5], evicted)
+	assert(s.Stats().Evictions == 5, "exp 5 evictions in stats, saw %d", s.Stats().Evictions)
+
+	n = s.EvictN(100)
+	assert(n == size-5, "exp %d evictions, saw %d", size-5, n)
+	assert(s.Len() == 0, "exp empty cache, saw %d", s.Len())
+	assert(s.EvictN(1) == 0, "exp no evictions from an empty cache")
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
+
+func TestResizeKeepVisited(t *testing.T) {
+	assert := newAsserter(t)
+
+	fill := func() *sieve.Sieve[int, int] {
+		s := sieve.New[int, int](10)
+		for i := 0; i < 10; i++ {
+			s.Add(i, i)
+		}
+		// visit the oldest half
+		for i := 0; i < 5; i++ {
+			s.Get(i)
+		}
+		return s
+	}
+
+	// Resize clears the flags of the visited entries and then evicts
+	// them once the unvisited ones are gone.
+	s := fill()
+	s.Resize(3)
+	for i := 0; i < 5; i++ {
+		_, ok := s.Inspect().Visited[i]
+		assert(!ok || i >= 2, "resize: exp %d to be evicted", i)
+	}
+
+	s = fill()
+	s.ResizeKeepVisited(3)
+	assert(s.Len() == 3 && s.Cap() == 3, "exp len 3, cap 3; saw %d, %d", s.Len(), s.Cap())
+	st := s.Inspect()
+	for i := 2; i < 5; i++ {
+		assert(st.Visited[i], "exp visited %d to be retained: %v", i, st.Visited)
+	}
+	assert(s.Stats().Evictions == 7, "exp 7 evictions, saw %d", s.Stats().Evictions)
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+
+	// fewer visited entries than the new capacity
+	s = fill()
+	s.ResizeKeepVisited(7)
+	st = s.Inspect()
+	for i := 0; i < 5; i++ {
+		assert(st.Visited[i], "exp visited %d to be retained: %v", i, st.Visited)
+	}
+	_, ok := st.Visited[8]
+	assert(ok && s.Len() == 7, "exp newest unvisited entries to be retained: %v", st.Visited)
+}
+
+func TestColdestN(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](8)
+	for i := 0; i < 8; i++ {
+		s.Add(i, i)
+	}
+
+	// 0 is the tail; visit 0, 1 and 3. The hand spares them on its
+	// first pass and evicts them only after all the others.
+	for _, k := range []int{0, 1, 3} {
+		s.Get(k)
+	}
+
+	cold := s.ColdestN(3)
+	assert(fmt.Sprint(cold) == "[2 4 5]", "exp [2 4 5], saw %v", cold)
+
+	cold = s.ColdestN(7)
+	assert(fmt.Sprint(cold) == "[2 4 5 6 7 0 1]", "exp [2 4 5 6 7 0 1], saw %v", cold)
+	assert(len(s.ColdestN(100)) == 8, "exp all keys")
+	assert(s.ColdestN(0) == nil, "exp nil for n=0")
+
+	// the simulation didn't clear any flags
+	st := s.Inspect()
+	assert(st.Visited[0] && st.Visited[1] && st.Visited[3], "flags changed: %v", st.Visited)
+
+	// and it matches the actual evictions
+	for i := 0; i < 3; i++ {
+		s.Add(100+i, i)
+	}
+	for _, k := range []int{2, 4, 5} {
+		_, ok := s.Inspect().Visited[k]
+		assert(!ok, "exp %d to be evicted", k)
+	}
+}
+
+func TestSortedEntries(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[string, int](8)
+	vals := map[string]int{"a": 5, "b": 1, "c": 9, "d": 3, "e": 5}
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		s.Add(k, vals[k])
+	}
+
+	ents := s.SortedEntries(func(a, b sieve.Entry[string, int]) bool {
+		return a.Value > b.Value
+	})
+
+	var keys []string
+	for _, e := range ents {
+		assert(e.Value == vals[e.Key], "%s: wrong value %d", e.Key, e.Value)
+		keys = append(keys, e.Key)
+	}
+
+	// "e" and "a" tie; the newer one comes first
+	exp := "[c e a d b]"
+	assert(fmt.Sprint(keys) == exp, "exp %s, saw %v", exp, keys)
+	assert(!s.Inspect().Visited["c"], "exp entries to stay unvisited")
+}
+
+func TestGetVisited(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](2)
+	s.Add(1, 10)
+
+	v, was, ok := s.GetVisited(1)
+	assert(ok && v == 10 && !was, "first get: saw %d %v %v", v, was, ok)
+	v, was, ok = s.GetVisited(1)
+	assert(ok && v == 10 && was, "second get: saw %d %v %v", v, was, ok)
+
+	// the hand clears the flag
+	s.Add(2, 20)
+	s.Add(3, 30)
+	_, was, ok = s.GetVisited(1)
+	assert(ok && !was, "exp 1 to be cleared by the hand, saw %v %v", was, ok)
+
+	_, was, ok = s.GetVisited(5)
+	assert(!ok && !was, "exp miss")
+}
+
+func TestConcurrentReplace(t *testing.T) {
+	assert := newAsserter(t)
+
+	// replacing a value must never write to a node that was recycled
+	// for another key; a tiny preallocated cache recycles constantly.
+	s := sieve.NewWithOptions[int, int](2, sieve.WithPrealloc[int, int](2))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for j := 0; j < 20000; j++ {
+				k := r.Intn(4)
+				switch j % 3 {
+				case 0:
+					s.Add(k, k)
+				case 1:
+					s.Touch(k, time.Hour)
+				default:
+					if v, ok := s.Get(k); ok {
+						assert(v == k, "get %d: wrong value %d", k, v)
+					}
+				}
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
+
+func TestConcurrentSizer(t *testing.T) {
+	assert := newAsserter(t)
+
+	// concurrent replacements of recycled nodes must keep the bytes
+	// cached in step with the live entries.
+	sizer := func(_ int, v int) int64 { return int64(v%5 + 1) }
+	s := sieve.NewWithSizer[int, int](8, sizer)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for j := 0; j < 20000; j++ {
+				s.Add(j%16, r.Intn(100))
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	var sum int64
+	items, _ := s.Snapshot()
+	for _, e := range items {
+		sum += sizer(e.Key, e.Value)
+	}
+	st := s.Stats()
+	assert(st.BytesCached == sum, "exp %d bytes cached, saw %d", sum, st.BytesCached)
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
+
+func TestConcurrentProbe(t *testing.T) {
+	assert := newAsserter(t)
+
+	// concurrent probes for the same missing key must add it exactly
+	// once and all see the value that was added.
+	const nr = 4
+	s := sieve.New[int, int](1024)
+	for k := 0; k < 5000; k++ {
+		var wg sync.WaitGroup
+		var added atomic.Int32
+		vals := make([]int, nr)
+		for i := 0; i < nr; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				v, ok := s.Probe(k, i)
+				if !ok {
+					added.Add(1)
+				}
+				vals[i] = v
+			}(i)
+		}
+		wg.Wait()
+
+		assert(added.Load() == 1, "key %d: exp 1 insert, saw %d", k, added.Load())
+		v, _ := s.Get(k)
+		for i := range vals {
+			assert(vals[i] == v, "key %d: exp %d, saw %d", k, v, vals[i])
+		}
+	}
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
+
 type timing struct {
 	typ       string
 	d         time.Duration
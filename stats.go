@@ -0,0 +1,318 @@
+// stats.go - cache statistics
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Stats is a snapshot of the cache statistics
+type Stats struct {
+	// number of lookups that found the key
+	Hits uint64
+
+	// number of lookups that didn't find the key
+	Misses uint64
+
+	// number of entries removed to make room for new ones
+	Evictions uint64
+
+	// number of adds that inserted a new entry
+	Inserts uint64
+
+	// number of adds that overwrote the value of an existing entry
+	Replacements uint64
+
+	// number of visited entries skipped by the hand while looking
+	// for eviction victims
+	EvictScans uint64
+
+	// number of lookups that found an expired entry and removed it;
+	// these are also counted as misses.
+	ExpiredOnAccess uint64
+
+	// approximate bytes held by the cache; this is only tracked
+	// by caches created with NewWithSizer, WithSizer or WithWeigher
+	// (where it is the total weight of the entries).
+	BytesCached int64
+}
+
+// stats holds the live counters; they're updated without holding
+// the cache lock.
+type stats struct {
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+	scans     atomic.Uint64
+	inserts   atomic.Uint64
+	replaced  atomic.Uint64
+	expired   atomic.Uint64
+	bytes     atomic.Int64
+}
+
+// Stats returns a snapshot of the cache statistics
+func (s *Sieve[K, V]) Stats() Stats {
+	var out Stats
+	s.StatsInto(&out)
+	return out
+}
+
+// StatsInto fills 'out' with a snapshot of the cache statistics; this
+// lets a metrics loop reuse a single Stats.
+func (s *Sieve[K, V]) StatsInto(out *Stats) {
+	st := &s.stats
+	*out = Stats{
+		Hits:         st.hits.Load(),
+		Misses:       st.misses.Load(),
+		Evictions:    st.evictions.Load(),
+		Inserts:      st.inserts.Load(),
+		Replacements: st.replaced.Load(),
+		EvictScans:   st.scans.Load(),
+		BytesCached:  st.bytes.Load(),
+
+		ExpiredOnAccess: st.expired.Load(),
+	}
+}
+
+// ResetStats zeroes the cache statistics without affecting the
+// cache contents. This is useful for computing per-interval metrics.
+// BytesCached describes the cache contents; it is not reset.
+func (s *Sieve[K, V]) ResetStats() {
+	st := &s.stats
+	st.hits.Store(0)
+	st.misses.Store(0)
+	st.evictions.Store(0)
+	st.inserts.Store(0)
+	st.replaced.Store(0)
+	st.scans.Store(0)
+	st.expired.Store(0)
+}
+
+// AvgEvictScan returns the average number of visited entries the
+// hand skipped per eviction. A high value means most entries are
+// being protected by recent accesses and the cache is under pressure.
+func (s *Sieve[K, V]) AvgEvictScan() float64 {
+	st := &s.stats
+	n := st.evictions.Load()
+	if n == 0 {
+		return 0
+	}
+	return float64(st.scans.Load()) / float64(n)
+}
+
+// RateStats is the rate of cache events per second over an interval
+type RateStats struct {
+	HitsPerSec      float64
+	MissesPerSec    float64
+	EvictionsPerSec float64
+
+	// Interval is the time over which the rates were computed
+	Interval time.Duration
+}
+
+// rates is the state of the counters at the start of an interval
+type rates struct {
+	sync.Mutex
+	at        time.Time
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// RateStats returns the hit, miss and eviction rates since the last
+// call to RateStats - or since the cache was created. Counters that
+// went backwards (due to ResetStats) are treated as starting at zero.
+// The rates are zero if no time has elapsed.
+func (s *Sieve[K, V]) RateStats() RateStats {
+	st := &s.stats
+	hits := st.hits.Load()
+	misses := st.misses.Load()
+	evictions := st.evictions.Load()
+	now := s.clock.Now()
+
+	r := &s.rates
+	r.Lock()
+	defer r.Unlock()
+
+	rs := RateStats{
+		Interval: now.Sub(r.at),
+	}
+	if secs := rs.Interval.Seconds(); secs > 0 {
+		rs.HitsPerSec = float64(delta(hits, r.hits)) / secs
+		rs.MissesPerSec = float64(delta(misses, r.misses)) / secs
+		rs.EvictionsPerSec = float64(delta(evictions, r.evictions)) / secs
+	}
+
+	r.at = now
+	r.hits, r.misses, r.evictions = hits, misses, evictions
+	return rs
+}
+
+// thrash is the state of the thrashing detector (see IsThrashing)
+type thrash struct {
+	sync.Mutex
+	window   uint64
+	maxHit   float64
+	minEvict float64
+
+	// the counters at the start of the current window
+	hits      uint64
+	lookups   uint64
+	evictions uint64
+	last      bool
+}
+
+// IsThrashing reports whether the working set appears to exceed the
+// cache capacity: over the most recent window of lookups, the hit
+// ratio was at most the configured maximum and the number of
+// evictions per lookup was at least the configured minimum. The
+// defaults are a window of 1024 lookups, a hit ratio of 0.2 and 0.5
+// evictions per lookup; WithThrashing changes them.
+//
+// The verdict is updated when a full window of lookups has elapsed
+// since the last update; until then IsThrashing returns the previous
+// verdict (initially false).
+func (s *Sieve[K, V]) IsThrashing() bool {
+	st := &s.stats
+	hits := st.hits.Load()
+	lookups := hits + st.misses.Load()
+	evictions := st.evictions.Load()
+
+	t := &s.thrash
+	t.Lock()
+	defer t.Unlock()
+
+	n := delta(lookups, t.lookups)
+	if n < t.window {
+		return t.last
+	}
+
+	hit := float64(delta(hits, t.hits)) / float64(n)
+	ev := float64(delta(evictions, t.evictions)) / float64(n)
+	t.last = hit <= t.maxHit && ev >= t.minEvict
+	t.hits, t.lookups, t.evictions = hits, lookups, evictions
+	return t.last
+}
+
+// delta returns the increase of a counter from 'old' to 'cur'
+func delta(cur, old uint64) uint64 {
+	if cur < old {
+		return cur
+	}
+	return cur - old
+}
+
+// ApproxMemoryBytes estimates the memory used by the cache itself:
+// the list nodes and the map entries indexing them. The value payloads
+// aren't included - unless the cache has a sizer (see WithSizer), in
+// which case BytesCached is added. This is a rough estimate for
+// capacity planning; it ignores allocator overhead, memory held by the
+// node pool and map buckets left behind by deleted entries.
+func (s *Sieve[K, V]) ApproxMemoryBytes() int64 {
+	var n Node[K, V]
+	var k K
+
+	s.mu.Lock()
+	size := int64(s.size)
+	s.mu.Unlock()
+
+	// a map entry holds the key and a node pointer; sync.Map adds an
+	// entry struct and boxes the key and value into interfaces.
+	ent := int64(unsafe.Sizeof(k)) + int64(unsafe.Sizeof(&n))
+	if s.stripes == 0 {
+		ent += 3 * int64(unsafe.Sizeof(any(nil)))
+	}
+
+	// maps are kept at most ~80% full
+	ent = ent * 5 / 4
+
+	// nodes carry metadata for the optional features they use
+	node := int64(unsafe.Sizeof(n))
+	if s.needsExt() || s.ttl > 0 {
+		node += int64(unsafe.Sizeof(nodeExt{}))
+	}
+
+	sz := int64(unsafe.Sizeof(*s)) + size*(node+ent)
+	if s.sizer != nil {
+		sz += s.stats.bytes.Load()
+	}
+	return sz
+}
+
+// hitWindow tracks the hits and misses of the last 'n' lookups in a
+// ring of bits: a set bit is a hit.
+type hitWindow struct {
+	n    uint64
+	bits []atomic.Uint64
+	pos  atomic.Uint64
+	hits atomic.Int64
+}
+
+func newHitWindow(n int) *hitWindow {
+	w := &hitWindow{
+		n:    uint64(n),
+		bits: make([]atomic.Uint64, (n+63)/64),
+	}
+	return w
+}
+
+// record the outcome of a lookup
+func (w *hitWindow) record(hit bool) {
+	i := (w.pos.Add(1) - 1) % w.n
+	word := &w.bits[i/64]
+	mask := uint64(1) << (i % 64)
+
+	for {
+		old := word.Load()
+		v := old &^ mask
+		if hit {
+			v |= mask
+		}
+
+		if word.CompareAndSwap(old, v) {
+			was := old&mask != 0
+			switch {
+			case hit && !was:
+				w.hits.Add(1)
+			case !hit && was:
+				w.hits.Add(-1)
+			}
+			return
+		}
+	}
+}
+
+// ratio returns the hit ratio over the window
+func (w *hitWindow) ratio() float64 {
+	n := min(w.pos.Load(), w.n)
+	if n == 0 {
+		return 0
+	}
+	return float64(w.hits.Load()) / float64(n)
+}
+
+// RecentHitRatio returns the hit ratio over the last N lookups - where
+// N is the window configured by WithHitWindow. Unlike the cumulative
+// ratio from Stats, this responds quickly to changes in the workload.
+// It returns 0 if the cache has no hit window.
+func (s *Sieve[K, V]) RecentHitRatio() float64 {
+	if s.window == nil {
+		return 0
+	}
+	return s.window.ratio()
+}
@@ -0,0 +1,370 @@
+// stats_test.go - tests for cache statistics
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencoff/go-sieve"
+)
+
+func TestResetStats(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](4)
+	for i := 0; i < 8; i++ {
+		s.Add(i, i)
+	}
+	for i := 0; i < 8; i++ {
+		s.Get(i)
+	}
+
+	st := s.Stats()
+	assert(st.Hits == 4, "exp 4 hits, saw %d", st.Hits)
+	assert(st.Misses == 4, "exp 4 misses, saw %d", st.Misses)
+	assert(st.Evictions == 4, "exp 4 evictions, saw %d", st.Evictions)
+
+	s.ResetStats()
+	st = s.Stats()
+	assert(st == sieve.Stats{}, "exp zero stats after reset, saw %+v", st)
+	assert(s.Len() == 4, "reset changed contents: len %d", s.Len())
+
+	// only post-reset activity must be counted
+	s.Get(7)
+	s.Get(100)
+	s.Probe(101, 101)
+
+	st = s.Stats()
+	assert(st.Hits == 1, "exp 1 hit, saw %d", st.Hits)
+	assert(st.Misses == 2, "exp 2 misses, saw %d", st.Misses)
+	assert(st.Evictions == 1, "exp 1 eviction, saw %d", st.Evictions)
+}
+
+func TestBytesCached(t *testing.T) {
+	assert := newAsserter(t)
+
+	sizer := func(k int, v []byte) int64 {
+		return int64(len(v))
+	}
+
+	s := sieve.NewWithSizer[int, []byte](8, sizer)
+	for i := 1; i <= 4; i++ {
+		s.Add(i, make([]byte, i*100))
+	}
+	st := s.Stats()
+	assert(st.BytesCached == 1000, "exp 1000 bytes, saw %d", st.BytesCached)
+
+	// replace
+	s.Add(4, make([]byte, 50))
+	st = s.Stats()
+	assert(st.BytesCached == 650, "exp 650 bytes, saw %d", st.BytesCached)
+
+	s.Delete(1)
+	s.Delete(2)
+	st = s.Stats()
+	assert(st.BytesCached == 350, "exp 350 bytes, saw %d", st.BytesCached)
+
+	// evictions: 3 is evicted first; 4 is visited (replaced) and
+	// survives at the expense of 10.
+	for i := 10; i < 18; i++ {
+		s.Add(i, make([]byte, 10))
+	}
+	st = s.Stats()
+	assert(st.BytesCached == 120, "exp 120 bytes, saw %d", st.BytesCached)
+
+	s.ResetStats()
+	st = s.Stats()
+	assert(st.BytesCached == 120, "reset: exp 120 bytes, saw %d", st.BytesCached)
+
+	s.Purge()
+	st = s.Stats()
+	assert(st.BytesCached == 0, "purge: exp 0 bytes, saw %d", st.BytesCached)
+
+	// no sizer
+	p := sieve.New[int, []byte](8)
+	p.Add(1, make([]byte, 100))
+	st = p.Stats()
+	assert(st.BytesCached == 0, "exp 0 bytes without sizer, saw %d", st.BytesCached)
+}
+
+func TestAvgEvictScan(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](4)
+	assert(s.AvgEvictScan() == 0, "exp 0 with no evictions")
+
+	for i := 0; i < 4; i++ {
+		s.Add(i, i)
+	}
+
+	// all visited: the first eviction clears all 4 flags and evicts 0
+	for i := 0; i < 4; i++ {
+		s.Get(i)
+	}
+	s.Add(4, 4)
+	assert(s.AvgEvictScan() == 4, "exp avg 4, saw %4.2f", s.AvgEvictScan())
+
+	// nothing visited now: the next eviction scans nothing
+	s.Add(5, 5)
+	assert(s.AvgEvictScan() == 2, "exp avg 2, saw %4.2f", s.AvgEvictScan())
+
+	st := s.Stats()
+	assert(st.Evictions == 2, "exp 2 evictions, saw %d", st.Evictions)
+	assert(st.EvictScans == 4, "exp 4 scans, saw %d", st.EvictScans)
+}
+
+func TestEvictScanBound(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](8)
+	for i := 0; i < 9; i++ {
+		s.Add(i, i)
+	}
+
+	// the hand is past the tail now; with every entry visited, the
+	// hand clears each flag once and evicts where it started.
+	for i := 1; i < 9; i++ {
+		s.Get(i)
+	}
+	s.Add(9, 9)
+	st := s.Stats()
+	assert(st.EvictScans == 8, "exp 8 scans, saw %d", st.EvictScans)
+	_, ok := s.Get(1)
+	assert(!ok, "exp 1 to be evicted")
+
+	// all flags are clear; so no more scanning
+	s.Add(10, 10)
+	st = s.Stats()
+	assert(st.EvictScans == 8, "exp no new scans, saw %d", st.EvictScans)
+	_, ok = s.Get(2)
+	assert(!ok, "exp 2 to be evicted")
+}
+
+func TestRecentHitRatio(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.NewWithOptions[int, int](64, sieve.WithHitWindow[int, int](100))
+	assert(s.RecentHitRatio() == 0, "exp 0 with no lookups")
+
+	for i := 0; i < 10; i++ {
+		s.Add(i, i)
+	}
+
+	for i := 0; i < 1000; i++ {
+		s.Get(i % 10)
+	}
+	assert(s.RecentHitRatio() == 1, "exp recent ratio 1, saw %4.2f", s.RecentHitRatio())
+
+	// a burst of misses
+	for i := 0; i < 50; i++ {
+		s.Get(1000 + i)
+	}
+
+	st := s.Stats()
+	cum := float64(st.Hits) / float64(st.Hits+st.Misses)
+	recent := s.RecentHitRatio()
+	assert(recent == 0.5, "exp recent ratio 0.5, saw %4.2f", recent)
+	assert(cum > 0.9, "exp cumulative ratio > 0.9, saw %4.2f", cum)
+
+	for i := 0; i < 100; i++ {
+		s.Get(1000 + i)
+	}
+	assert(s.RecentHitRatio() == 0, "exp recent ratio 0, saw %4.2f", s.RecentHitRatio())
+
+	// no window
+	p := sieve.New[int, int](4)
+	p.Get(1)
+	assert(p.RecentHitRatio() == 0, "exp 0 without a window")
+}
+
+func TestRateStats(t *testing.T) {
+	assert := newAsserter(t)
+
+	clk := newFakeClock()
+	s := sieve.NewWithOptions[int, int](2, sieve.WithClock[int, int](clk))
+
+	for i := 0; i < 4; i++ {
+		s.Add(i, i)
+	}
+	for i := 0; i < 10; i++ {
+		s.Get(3)
+	}
+	for i := 0; i < 5; i++ {
+		s.Get(100)
+	}
+
+	clk.Advance(2 * time.Second)
+	r := s.RateStats()
+	assert(r.Interval == 2*time.Second, "exp 2s interval, saw %s", r.Interval)
+	assert(r.HitsPerSec == 5, "exp 5 hits/s, saw %f", r.HitsPerSec)
+	assert(r.MissesPerSec == 2.5, "exp 2.5 misses/s, saw %f", r.MissesPerSec)
+	assert(r.EvictionsPerSec == 1, "exp 1 eviction/s, saw %f", r.EvictionsPerSec)
+
+	// the next interval only counts the new events
+	s.Get(3)
+	clk.Advance(500 * time.Millisecond)
+	r = s.RateStats()
+	assert(r.HitsPerSec == 2, "exp 2 hits/s, saw %f", r.HitsPerSec)
+	assert(r.MissesPerSec == 0, "exp 0 misses/s, saw %f", r.MissesPerSec)
+
+	// no time elapsed
+	r = s.RateStats()
+	assert(r.Interval == 0 && r.HitsPerSec == 0, "exp zero rates, saw %+v", r)
+}
+
+func TestStatsReplacements(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](4)
+	for i := 0; i < 6; i++ {
+		s.Add(i, i)
+	}
+	s.Add(4, 40)
+	s.Add(5, 50)
+	s.AddWithTTL(5, 500, time.Hour)
+	s.AddVisited(4, 400, false)
+	s.Probe(5, 5)
+	s.Probe(6, 6)
+
+	st := s.Stats()
+	assert(st.Inserts == 7, "exp 7 inserts, saw %d", st.Inserts)
+	assert(st.Replacements == 4, "exp 4 replacements, saw %d", st.Replacements)
+
+	s.ResetStats()
+	st = s.Stats()
+	assert(st.Inserts == 0 && st.Replacements == 0, "exp zero counters after reset, saw %+v", st)
+}
+
+func TestApproxMemoryBytes(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.New[int, int](4096)
+	empty := s.ApproxMemoryBytes()
+	assert(empty > 0, "exp non-zero footprint for an empty cache")
+
+	for i := 0; i < 1000; i++ {
+		s.Add(i, i)
+	}
+	m1 := s.ApproxMemoryBytes() - empty
+	for i := 1000; i < 2000; i++ {
+		s.Add(i, i)
+	}
+	m2 := s.ApproxMemoryBytes() - empty
+	assert(m1 > 0 && m2 == 2*m1, "exp footprint to scale with entries: %d, %d", m1, m2)
+
+	s.Purge()
+	assert(s.ApproxMemoryBytes() == empty, "exp empty footprint after purge")
+
+	// only the caches that use optional features pay for their
+	// per node metadata
+	h := sieve.NewWithHitCount[int, int](4096)
+	hempty := h.ApproxMemoryBytes()
+	for i := 0; i < 1000; i++ {
+		h.Add(i, i)
+	}
+	hm := h.ApproxMemoryBytes() - hempty
+	assert(hm > m1, "exp hit counting to cost more: %d, %d", hm, m1)
+
+	// a sizer adds the payloads
+	w := sieve.NewWithSizer[int, []byte](16, func(_ int, v []byte) int64 {
+		return int64(len(v))
+	})
+	w.Add(1, make([]byte, 10))
+	base := w.ApproxMemoryBytes()
+	w.Add(2, make([]byte, 1000))
+	assert(w.ApproxMemoryBytes()-base > 1000, "exp payload in footprint")
+}
+
+func TestIsThrashing(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.NewWithOptions[int, int](100, sieve.WithThrashing[int, int](200, 0.2, 0.5))
+
+	// a working set within the capacity
+	for i := 0; i < 2000; i++ {
+		k := i % 80
+		s.Probe(k, k)
+		assert(!s.IsThrashing(), "%d: steady state flagged as thrashing", i)
+	}
+
+	// a working set 10x the capacity: every lookup misses and evicts
+	for i := 0; i < 1000; i++ {
+		k := i % 1000
+		s.Probe(k+1000, k)
+	}
+	assert(s.IsThrashing(), "exp thrashing with a large working set")
+
+	// and back to a small working set
+	for i := 0; i < 1000; i++ {
+		k := i % 50
+		s.Probe(k, k)
+	}
+	assert(!s.IsThrashing(), "exp thrashing to stop")
+
+	// misses without inserts aren't thrashing
+	for i := 0; i < 1000; i++ {
+		s.Get(5000 + i)
+	}
+	assert(!s.IsThrashing(), "exp misses without evictions to not be thrashing")
+}
+
+func TestStatsExpiredOnAccess(t *testing.T) {
+	assert := newAsserter(t)
+
+	clk := newFakeClock()
+	s := sieve.NewWithOptions[int, int](4, sieve.WithClock[int, int](clk))
+	s.AddWithTTL(1, 1, time.Millisecond)
+	s.AddWithTTL(2, 2, time.Millisecond)
+	s.Add(3, 3)
+
+	clk.Advance(2 * time.Millisecond)
+	_, ok := s.Get(1)
+	assert(!ok, "exp 1 to have expired")
+	_, ok = s.Get(100)
+	assert(!ok, "exp miss on 100")
+
+	st := s.Stats()
+	assert(st.ExpiredOnAccess == 1, "exp 1 expired on access, saw %d", st.ExpiredOnAccess)
+	assert(st.Misses == 2, "exp 2 misses, saw %d", st.Misses)
+
+	// the removed entry is a plain miss now
+	s.Get(1)
+	assert(s.Stats().ExpiredOnAccess == 1, "exp no change, saw %d", s.Stats().ExpiredOnAccess)
+
+	// a sweep doesn't count as an access
+	n := s.RemoveExpired()
+	assert(n == 1, "exp to remove 2, saw %d", n)
+	assert(s.Stats().ExpiredOnAccess == 1, "exp no change, saw %d", s.Stats().ExpiredOnAccess)
+}
+
+func TestStatsInto(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.NewWithSizer[int, int](4, func(k, v int) int64 { return 8 })
+	for i := 0; i < 8; i++ {
+		s.Add(i, i)
+		s.Get(i / 2)
+	}
+
+	st := sieve.Stats{Hits: 1000}
+	s.StatsInto(&st)
+	assert(st == s.Stats(), "exp %+v, saw %+v", s.Stats(), st)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		s.StatsInto(&st)
+	})
+	assert(allocs == 0, "exp no allocations, saw %f", allocs)
+}
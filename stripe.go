@@ -0,0 +1,130 @@
+// stripe.go - lock striped key to node index
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve
+
+import (
+	"sync"
+)
+
+// WithStripes indexes the cache entries in 'n' independently locked
+// maps - selected by 'hash(key)' - instead of a single sync.Map.
+// Lookups take a read lock on one stripe; the cache lock still guards
+// the list and is only taken to insert, remove or evict entries.
+// sync.Map is best for read-mostly workloads with a stable key set;
+// striping does better when entries churn - every miss that inserts a
+// new entry is a map write. A writer waiting on a stripe blocks new
+// readers of that stripe; so readers can't starve writers. 'hash' must
+// be deterministic and should spread the keys evenly; 'n' is rounded
+// up to a power of 2.
+func WithStripes[K comparable, V any](n int, hash func(K) uint64) Option[K, V] {
+	return func(s *Sieve[K, V]) {
+		s.stripes = pow2(max(n, 1))
+		s.hash = hash
+		s.cache = s.newMap()
+	}
+}
+
+// kvmap is the index from keys to cache nodes
+type kvmap[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Put(key K, val V)
+	Del(key K) (V, bool)
+	Len() int
+}
+
+// newMap returns an empty index of the configured kind
+func (s *Sieve[K, V]) newMap() kvmap[K, *Node[K, V]] {
+	if s.stripes > 0 {
+		return newStripedMap[K, *Node[K, V]](s.stripes, s.hash)
+	}
+	return newSyncMap[K, *Node[K, V]]()
+}
+
+// stripedMap is a map sharded into independently locked stripes
+type stripedMap[K comparable, V any] struct {
+	hash    func(K) uint64
+	mask    uint64
+	stripes []stripe[K, V]
+}
+
+type stripe[K comparable, V any] struct {
+	sync.RWMutex
+	m map[K]V
+
+	// keep adjacent stripe locks off the same cache line
+	_ [40]byte
+}
+
+func newStripedMap[K comparable, V any](n int, hash func(K) uint64) *stripedMap[K, V] {
+	m := &stripedMap[K, V]{
+		hash:    hash,
+		mask:    uint64(n - 1),
+		stripes: make([]stripe[K, V], n),
+	}
+	for i := range m.stripes {
+		m.stripes[i].m = make(map[K]V)
+	}
+	return m
+}
+
+func (m *stripedMap[K, V]) stripe(key K) *stripe[K, V] {
+	return &m.stripes[m.hash(key)&m.mask]
+}
+
+func (m *stripedMap[K, V]) Get(key K) (V, bool) {
+	st := m.stripe(key)
+	st.RLock()
+	v, ok := st.m[key]
+	st.RUnlock()
+	return v, ok
+}
+
+func (m *stripedMap[K, V]) Put(key K, val V) {
+	st := m.stripe(key)
+	st.Lock()
+	st.m[key] = val
+	st.Unlock()
+}
+
+func (m *stripedMap[K, V]) Del(key K) (V, bool) {
+	st := m.stripe(key)
+	st.Lock()
+	v, ok := st.m[key]
+	if ok {
+		delete(st.m, key)
+	}
+	st.Unlock()
+	return v, ok
+}
+
+func (m *stripedMap[K, V]) Len() int {
+	var n int
+	for i := range m.stripes {
+		st := &m.stripes[i]
+		st.RLock()
+		n += len(st.m)
+		st.RUnlock()
+	}
+	return n
+}
+
+// pow2 rounds 'n' up to the next power of 2
+func pow2(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
@@ -0,0 +1,146 @@
+// stripe_test.go -- tests for the lock striped index
+//
+// (c) 2024 Sudhi Herle <sudhi@herle.net>
+//
+// Copyright 2024- Sudhi Herle <sw-at-herle-dot-net>
+// License: BSD-2-Clause
+//
+// If you need a commercial license for this work, please contact
+// the author.
+//
+// This software does not come with any express or implied
+// warranty; it is provided "as is". No claim  is made to its
+// suitability for any purpose.
+
+package sieve_test
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencoff/go-sieve"
+)
+
+func TestStripes(t *testing.T) {
+	assert := newAsserter(t)
+
+	s := sieve.NewWithOptions[uint64, uint64](64,
+		sieve.WithStripes[uint64, uint64](5, mix64))
+
+	for i := uint64(0); i < 100; i++ {
+		s.Add(i, i)
+	}
+	assert(s.Len() == 64, "exp 64 entries, saw %d", s.Len())
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+
+	for i := uint64(36); i < 100; i++ {
+		v, ok := s.Get(i)
+		assert(ok && v == i, "%d: exp to find it, saw %d %v", i, v, ok)
+	}
+	assert(s.Delete(99), "exp to delete 99")
+	_, ok := s.Get(99)
+	assert(!ok, "exp 99 to be gone")
+
+	// the rebuilt maps are striped too
+	s.ShrinkToFit()
+	assert(s.Validate() == nil, "shrink: %v", s.Validate())
+	s.Purge()
+	assert(s.Len() == 0, "exp empty cache, saw %d", s.Len())
+	s.Add(1, 1)
+	v, ok := s.Get(1)
+	assert(ok && v == 1, "exp to find 1 after purge")
+}
+
+func TestStripesConcurrent(t *testing.T) {
+	assert := newAsserter(t)
+
+	size := 256
+	s := sieve.NewWithOptions[uint64, uint64](size,
+		sieve.WithStripes[uint64, uint64](16, mix64))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for j := 0; j < 20000; j++ {
+				k := uint64(r.Intn(size * 2))
+				switch j % 4 {
+				case 0:
+					s.Add(k, k)
+				case 1:
+					s.Delete(k)
+				default:
+					if v, ok := s.Probe(k, k); ok {
+						assert(v == k, "%d: wrong value %d", k, v)
+					}
+				}
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	assert(s.Len() <= size, "len %d exceeds cap %d", s.Len(), size)
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}
+
+func TestWriterProgress(t *testing.T) {
+	caches := map[string]*sieve.Sieve[uint64, uint64]{
+		"syncmap": sieve.New[uint64, uint64](1024),
+		"striped": sieve.NewWithOptions[uint64, uint64](1024,
+			sieve.WithStripes[uint64, uint64](4, mix64)),
+	}
+
+	for name, s := range caches {
+		t.Run(name, func(t *testing.T) {
+			testWriterProgress(t, s)
+		})
+	}
+}
+
+// testWriterProgress runs continuous readers and asserts that a
+// periodic writer is never blocked for long.
+func testWriterProgress(t *testing.T, s *sieve.Sieve[uint64, uint64]) {
+	assert := newAsserter(t)
+
+	for i := uint64(0); i < 512; i++ {
+		s.Add(i, i)
+	}
+
+	var wg, started sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		started.Add(1)
+		go func() {
+			defer wg.Done()
+			started.Done()
+			for k := uint64(0); ; k++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				s.Get(k % 512)
+			}
+		}()
+	}
+	started.Wait()
+
+	// keep writing for a while under the read load
+	var worst time.Duration
+	var adds uint64
+	for end := time.Now().Add(50 * time.Millisecond); time.Now().Before(end); adds++ {
+		start := time.Now()
+		s.Add(1000+adds, adds)
+		worst = max(worst, time.Since(start))
+	}
+	close(done)
+	wg.Wait()
+
+	assert(adds > 0 && worst < time.Second, "writer starved: %d adds, worst took %s", adds, worst)
+	assert(s.Validate() == nil, "invariants: %v", s.Validate())
+}